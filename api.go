@@ -0,0 +1,46 @@
+package rest
+
+import (
+	"context"
+	"time"
+)
+
+// API is the interface of Client, for consumers to depend on instead of the
+// concrete type. The resttest package provides a fake implementation.
+type API interface {
+	CreateTunnelV4(ctx context.Context, req *CreateTunnelRequestV4, timeout time.Duration) (TunnelStateWithMessages, error)
+	CreateTunnelV5(ctx context.Context, req *CreateTunnelRequestV5, timeout time.Duration) (TunnelStateWithMessages, error)
+	CreateVPNProxy(ctx context.Context, req *CreateTunnelRequestV4, timeout time.Duration) (TunnelStateWithMessages, error)
+
+	TunnelState(ctx context.Context, id string) (TunnelState, error)
+	ListTunnels(protocol ...Protocol) ([]string, error)
+	ListTunnelStates(protocol ...Protocol) ([]TunnelState, error)
+	ListSharedTunnels(protocol ...Protocol) (map[string][]string, error)
+	ListSharedTunnelStates(protocol ...Protocol) (map[string][]TunnelState, error)
+	ListAllTunnelStates(limit int) ([]TunnelState, error)
+	ListVPNProxies() ([]string, error)
+	ListVPNStates() ([]TunnelState, error)
+	ListSharedVPNs() (map[string][]string, error)
+	ListSharedVPNStates() (map[string][]TunnelState, error)
+	WalkTunnelStates(ctx context.Context, fn func(TunnelState) error, protocol ...Protocol) error
+	WalkSharedTunnelStates(ctx context.Context, fn func(owner string, state TunnelState) error, protocol ...Protocol) error
+	WalkAllTunnelStates(ctx context.Context, limit int, fn func(TunnelState) error) error
+
+	ShutdownTunnel(ctx context.Context, id string, reason string, wait bool) (int, error)
+	ShutdownVPNProxy(ctx context.Context, id string, reason string, wait bool) (int, error)
+
+	GetSCUpdates(
+		ctx context.Context, platform, version, configuration, region, tunnelName string, isTunnelPool bool,
+	) (SCUpdates, error)
+	GetVersions(platform, version string, all bool) (SCVersions, error)
+	UpdateClientStatus(
+		ctx context.Context, id string, connected bool, duration time.Duration, memory *Memory,
+	) (UpdateClientStatusResponse, error)
+	ReportCrash(tunnel, info, logs string) error
+
+	Reattach(ctx context.Context, resume bool) ([]ReattachResult, error)
+	Heartbeat(ctx context.Context, id string, interval time.Duration, onError func(error))
+}
+
+// Client must implement every method of API.
+var _ API = (*Client)(nil)
@@ -0,0 +1,20 @@
+package rest
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestAPICoversClient makes sure new public methods of Client are added to API.
+func TestAPICoversClient(t *testing.T) {
+	api := reflect.TypeOf((*API)(nil)).Elem()
+	client := reflect.TypeOf(&Client{})
+
+	for i := 0; i < client.NumMethod(); i++ {
+		name := client.Method(i).Name
+
+		if _, ok := api.MethodByName(name); !ok {
+			t.Errorf("Client.%s is missing from API", name)
+		}
+	}
+}
@@ -0,0 +1,318 @@
+package rest
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Audited operations.
+const (
+	AuditCreate             = "create"
+	AuditShutdown           = "shutdown"
+	AuditUpdateClientStatus = "update_client_status"
+	AuditReportCrash        = "report_crash"
+)
+
+// Audit record outcomes.
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+)
+
+// AuditRecord is a record of a mutating operation.
+type AuditRecord struct {
+	// Seq is the position of the record in the log, starting at 1.
+	Seq       int64     `json:"seq"`
+	Time      time.Time `json:"time"`
+	End       time.Time `json:"end"`
+	Operation string    `json:"operation"`
+
+	User        string `json:"user"`
+	TunnelOwner string `json:"tunnel_owner,omitempty"`
+	// Target is the tunnel ID.
+	Target string `json:"target,omitempty"`
+	// Params are the redacted operation parameters.
+	Params json.RawMessage `json:"params,omitempty"`
+
+	Outcome    string `json:"outcome"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+
+	// PrevHash is the Hash of the previous record, empty for the first one.
+	PrevHash string `json:"prev_hash"`
+	// Hash is the SHA-256 of the record with an empty Hash.
+	Hash string `json:"hash"`
+}
+
+// computeHash returns the hash of the record, ignoring its Hash.
+func (r AuditRecord) computeHash() (string, error) {
+	r.Hash = ""
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// AuditSink records mutating operations.
+type AuditSink interface {
+	Record(AuditRecord) error
+}
+
+// AuditLog is an append-only, hash-chained JSON Lines AuditSink. Each record
+// carries the hash of the previous one, so that edits, insertions and
+// deletions are detected by VerifyAuditLog. It's safe for concurrent use.
+type AuditLog struct {
+	// Path of the log file. Records are appended to an existing log.
+	Path string
+
+	mu       sync.Mutex
+	file     *os.File
+	seq      int64
+	lastHash string
+}
+
+// Record interface implementation. Seq, PrevHash and Hash are set.
+func (l *AuditLog) Record(rec AuditRecord) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		if err := l.open(); err != nil {
+			return err
+		}
+	}
+
+	rec.Seq = l.seq + 1
+	rec.PrevHash = l.lastHash
+
+	hash, err := rec.computeHash()
+	if err != nil {
+		return err
+	}
+
+	rec.Hash = hash
+
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	if _, err := l.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+
+	if err := l.file.Sync(); err != nil {
+		return err
+	}
+
+	l.seq, l.lastHash = rec.Seq, rec.Hash
+
+	return nil
+}
+
+// Head returns the hash of the last record. Storing it elsewhere allows to
+// detect the truncation of the log.
+func (l *AuditLog) Head() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.lastHash
+}
+
+// Close closes the log file.
+func (l *AuditLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+
+	err := l.file.Close()
+	l.file = nil
+
+	return err
+}
+
+// open opens the log file, and continues the chain of the existing records.
+func (l *AuditLog) open() error {
+	f, err := os.OpenFile(l.Path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+
+	l.seq, l.lastHash = 0, ""
+
+	last, err := verifyAuditLog(f)
+	if err != nil {
+		f.Close()
+
+		return err
+	}
+
+	if last != nil {
+		l.seq, l.lastHash = last.Seq, last.Hash
+	}
+
+	l.file = f
+
+	return nil
+}
+
+// AuditVerifyError is returned by VerifyAuditLog for a tampered log.
+type AuditVerifyError struct {
+	// Line of the first invalid record, starting at 1.
+	Line   int
+	Reason string
+}
+
+// Error interface implementation.
+func (e *AuditVerifyError) Error() string {
+	return fmt.Sprintf("audit log line %d: %s", e.Line, e.Reason)
+}
+
+// VerifyAuditLog checks the hash chain of the log read from `r`. It returns
+// an *AuditVerifyError for the first record that was edited, inserted or
+// removed. The truncation of the end of the log can only be detected by
+// comparing the last hash with a stored AuditLog.Head.
+func VerifyAuditLog(r io.Reader) (last *AuditRecord, err error) {
+	return verifyAuditLog(r)
+}
+
+func verifyAuditLog(r io.Reader) (*AuditRecord, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	var last *AuditRecord
+
+	for line := 1; scanner.Scan(); line++ {
+		var rec AuditRecord
+
+		dec := json.NewDecoder(bytes.NewReader(scanner.Bytes()))
+		dec.DisallowUnknownFields()
+
+		if err := dec.Decode(&rec); err != nil {
+			return last, &AuditVerifyError{Line: line, Reason: fmt.Sprintf("invalid record: %v", err)}
+		}
+
+		wantSeq, wantPrev := int64(1), ""
+		if last != nil {
+			wantSeq, wantPrev = last.Seq+1, last.Hash
+		}
+
+		if rec.Seq != wantSeq {
+			return last, &AuditVerifyError{Line: line, Reason: fmt.Sprintf("sequence %d, expected %d", rec.Seq, wantSeq)}
+		}
+
+		if rec.PrevHash != wantPrev {
+			return last, &AuditVerifyError{Line: line, Reason: "previous hash mismatch"}
+		}
+
+		hash, err := rec.computeHash()
+		if err != nil {
+			return last, err
+		}
+
+		if rec.Hash != hash {
+			return last, &AuditVerifyError{Line: line, Reason: "hash mismatch"}
+		}
+
+		last = &rec
+	}
+
+	return last, scanner.Err()
+}
+
+// AuditError is returned when an operation couldn't be recorded. The
+// operation itself succeeded, and its result is returned along with the error.
+type AuditError struct {
+	Operation string
+	Err       error
+}
+
+// Error interface implementation.
+func (e *AuditError) Error() string {
+	return fmt.Sprintf("audit %s: %v", e.Operation, e.Err)
+}
+
+// Unwrap interface implementation.
+func (e *AuditError) Unwrap() error { return e.Err }
+
+// recordAudit records the operation `op` if the client has an Audit sink.
+// `opErr` is the error of the operation. Recording errors are *AuditError.
+func (c *Client) recordAudit(op, target string, params interface{}, start time.Time, opErr error) error {
+	if c.Audit == nil {
+		return nil
+	}
+
+	rec := AuditRecord{
+		Time:        start.UTC(),
+		End:         time.Now().UTC(),
+		Operation:   op,
+		User:        c.User,
+		TunnelOwner: c.TunnelOwner,
+		Target:      target,
+		Params:      c.auditParams(params),
+		Outcome:     AuditSuccess,
+	}
+
+	if opErr != nil {
+		rec.Outcome = AuditFailure
+		rec.Error = c.redact(opErr.Error())
+
+		var cE *ClientError
+		if errors.As(opErr, &cE) {
+			rec.StatusCode = cE.StatusCode
+		}
+	}
+
+	if err := c.Audit.Record(rec); err != nil {
+		return &AuditError{Operation: op, Err: err}
+	}
+
+	return nil
+}
+
+// auditParams returns the redacted JSON of `params`.
+func (c *Client) auditParams(params interface{}) json.RawMessage {
+	if params == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(params)
+	if err != nil {
+		return nil
+	}
+
+	redacted := []byte(c.redact(string(data)))
+	if !json.Valid(redacted) {
+		// Keep the record valid, the params are still redacted.
+		redacted, _ = json.Marshal(string(redacted))
+	}
+
+	return redacted
+}
+
+// audit records the operation, and returns `opErr`, or the recording error if
+// the operation succeeded.
+func (c *Client) audit(op, target string, params interface{}, start time.Time, opErr error) error {
+	if err := c.recordAudit(op, target, params, start, opErr); err != nil && opErr == nil {
+		return err
+	}
+
+	return opErr
+}
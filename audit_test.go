@@ -0,0 +1,211 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/saucelabs/tunnelrest-go/util"
+	assertLib "github.com/stretchr/testify/assert"
+)
+
+func readAuditLog(t *testing.T, path string) []AuditRecord {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	assertLib.NoError(t, err)
+
+	var records []AuditRecord
+
+	for _, line := range bytes.Split(bytes.TrimSpace(data), []byte("\n")) {
+		var rec AuditRecord
+		assertLib.NoError(t, json.Unmarshal(line, &rec))
+		records = append(records, rec)
+	}
+
+	return records
+}
+
+func TestClientAudit(t *testing.T) {
+	assert := assertLib.New(t)
+
+	_, server := newFakeTunnelAPI()
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	log := &AuditLog{Path: path}
+	defer log.Close()
+
+	redactor := util.NewRedactor()
+	redactor.AddSecret("build-t0k3n")
+
+	c := &Client{
+		BaseURL:     server.URL,
+		User:        tunnelUser,
+		APIKey:      "s3cr3t-k3y",
+		TunnelOwner: "team",
+		Audit:       log,
+		Redactor:    redactor,
+	}
+
+	tunnel, err := c.CreateTunnelV5(context.Background(), &CreateTunnelRequestV5{
+		TunnelIdentifier: "app",
+		Metadata:         Metadata{CommandArgs: "-k s3cr3t-k3y --tags build-t0k3n"},
+	}, time.Second)
+	assert.NoError(err)
+
+	_, err = c.UpdateClientStatus(context.Background(), tunnel.ID, true, time.Second, nil)
+	assert.NoError(err)
+
+	_, err = c.ShutdownTunnel(context.Background(), tunnel.ID, "sigterm", true)
+	assert.NoError(err)
+
+	// Crash reports aren't supported by the fake API.
+	assert.Error(c.ReportCrash(tunnel.ID, "panic", "logs"))
+
+	records := readAuditLog(t, path)
+	assert.Len(records, 4)
+
+	ops := make([]string, len(records))
+	for i, r := range records {
+		ops[i] = r.Operation
+		assert.Equal(tunnelUser, r.User)
+		assert.Equal("team", r.TunnelOwner)
+		assert.Equal(tunnel.ID, r.Target)
+		assert.False(r.End.Before(r.Time))
+	}
+
+	assert.Equal([]string{AuditCreate, AuditUpdateClientStatus, AuditShutdown, AuditReportCrash}, ops)
+	assert.NotContains(string(records[0].Params), "s3cr3t-k3y")
+	assert.NotContains(string(records[0].Params), "build-t0k3n")
+	assert.JSONEq(`{"reason": "sigterm", "wait": true}`, string(records[2].Params))
+	assert.Equal(AuditSuccess, records[2].Outcome)
+	assert.Equal(AuditFailure, records[3].Outcome)
+	assert.Equal(404, records[3].StatusCode)
+
+	f, err := os.Open(path)
+	assert.NoError(err)
+	defer f.Close()
+
+	last, err := VerifyAuditLog(f)
+	assert.NoError(err)
+	assert.Equal(log.Head(), last.Hash)
+}
+
+func TestAuditLogReopen(t *testing.T) {
+	assert := assertLib.New(t)
+
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	log := &AuditLog{Path: path}
+	assert.NoError(log.Record(AuditRecord{Operation: AuditCreate}))
+	assert.NoError(log.Close())
+
+	log = &AuditLog{Path: path}
+	assert.NoError(log.Record(AuditRecord{Operation: AuditShutdown}))
+	assert.NoError(log.Close())
+
+	records := readAuditLog(t, path)
+	assert.Equal(int64(2), records[1].Seq)
+	assert.Equal(records[0].Hash, records[1].PrevHash)
+}
+
+func TestVerifyAuditLog(t *testing.T) {
+	assert := assertLib.New(t)
+
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	log := &AuditLog{Path: path}
+	for _, target := range []string{"t1", "t2", "t3"} {
+		assert.NoError(log.Record(AuditRecord{Operation: AuditCreate, Target: target}))
+	}
+	assert.NoError(log.Close())
+
+	data, err := os.ReadFile(path)
+	assert.NoError(err)
+
+	lines := strings.SplitAfter(string(data), "\n")
+
+	tests := []struct {
+		name string
+		log  string
+		want string
+	}{
+		{
+			name: "edited",
+			log:  strings.Replace(string(data), `"target":"t2"`, `"target":"t9"`, 1),
+			want: "audit log line 2: hash mismatch",
+		},
+		{
+			name: "removed",
+			log:  lines[0] + lines[2],
+			want: "audit log line 2: sequence 3, expected 2",
+		},
+		{
+			name: "reordered",
+			log:  lines[1] + lines[0],
+			want: "audit log line 1: sequence 2, expected 1",
+		},
+		{
+			name: "garbage",
+			log:  lines[0] + "{\n",
+			want: "audit log line 2: invalid record: unexpected EOF",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := VerifyAuditLog(strings.NewReader(tt.log))
+			assertLib.EqualError(t, err, tt.want)
+
+			var vErr *AuditVerifyError
+			assertLib.True(t, errors.As(err, &vErr))
+		})
+	}
+
+	// A tampered log can't be appended to.
+	assert.NoError(os.WriteFile(path, []byte(tests[0].log), 0o600))
+	assert.Error((&AuditLog{Path: path}).Record(AuditRecord{}))
+}
+
+// failingAuditSink fails to record.
+type failingAuditSink struct{}
+
+func (failingAuditSink) Record(AuditRecord) error { return errors.New("disk full") }
+
+func TestClientAuditFailure(t *testing.T) {
+	assert := assertLib.New(t)
+
+	api, server := newFakeTunnelAPI()
+	defer server.Close()
+
+	store := &SessionStore{Path: filepath.Join(t.TempDir(), "session.json")}
+	c := &Client{BaseURL: server.URL, User: tunnelUser, SessionStore: store, Audit: failingAuditSink{}}
+
+	// The tunnel is created, and its session saved, despite the audit error.
+	tunnel, err := c.CreateTunnelV5(context.Background(), &CreateTunnelRequestV5{TunnelIdentifier: "app"}, time.Second)
+
+	var auditErr *AuditError
+	assert.ErrorAs(err, &auditErr)
+	assert.Equal(AuditCreate, auditErr.Operation)
+	assert.EqualError(err, "audit create: disk full")
+	assert.NotEmpty(tunnel.ID)
+	assert.Equal(1, api.running())
+
+	sessions, _ := store.Load()
+	assert.Len(sessions, 1)
+
+	// The tunnel is shut down, and its session removed.
+	_, err = c.ShutdownTunnel(context.Background(), tunnel.ID, "sigterm", false)
+	assert.ErrorAs(err, &auditErr)
+	assert.Equal(0, api.running())
+
+	sessions, _ = store.Load()
+	assert.Empty(sessions)
+}
@@ -8,7 +8,9 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"reflect"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/saucelabs/tunnelrest-go/util"
@@ -17,6 +19,8 @@ import (
 const (
 	infoPath = "tunnels/info"
 
+	defaultMaxErrorBodySize = 64 * 1024
+
 	// KGPProtocol is the protocol used by Sauce Connect 4.x and below.
 	KGPProtocol Protocol = "kgp"
 
@@ -52,6 +56,96 @@ type Client struct {
 
 	// RoundTrip is used to make HTTP requests, if not set, the default http.Client is used.
 	RoundTrip func(*http.Request) (*http.Response, error)
+
+	// Middleware wraps every REST API call, the first one being the
+	// outermost, e.g. to layer retries, logging, metrics or caching.
+	Middleware []Middleware
+
+	// MaxResponseSize limits the size of response bodies, in bytes. Larger
+	// responses fail with a *ResponseTooLargeError. Unlimited if not set.
+	MaxResponseSize int64
+	// MaxErrorBodySize limits the size of the server response kept by a
+	// *ClientError, in bytes. Longer responses are truncated. Defaults to
+	// 64 KiB.
+	MaxErrorBodySize int64
+
+	// CollisionPolicy is applied when a tunnel is created with the identifier
+	// of an already running tunnel. Collisions are ignored by default.
+	CollisionPolicy CollisionPolicy
+
+	// MessageHandler, if set, is called for every message returned by tunnel
+	// creation and GetSCUpdates. Wrap it with NewDedupHandler to handle
+	// repeated messages once.
+	MessageHandler MessageHandler
+	// FatalAsError makes tunnel creation and GetSCUpdates return a
+	// *FatalMessageError when the server responds with fatal messages. The
+	// response is returned along with the error.
+	FatalAsError bool
+
+	// SessionStore, if set, persists created tunnels so that a restarted
+	// process can Reattach to them. Shut down tunnels are removed.
+	SessionStore *SessionStore
+
+	// OnDrift, if set, is called for every difference between a response and
+	// the type it's decoded to: unknown fields, missing required fields, i.e.
+	// without omitempty, and type mismatches. See DriftReport.
+	OnDrift func(Drift)
+	// StrictDecoding makes requests fail with a *DriftError when a response
+	// drifted, e.g. in tests.
+	StrictDecoding bool
+
+	// Audit, if set, records the mutating operations: tunnel creation and
+	// shutdown, client status updates and crash reports. See AuditLog. An
+	// operation that couldn't be recorded returns its result along with an
+	// *AuditError.
+	Audit AuditSink
+
+	// Redactor removes secrets from the errors, the audit records and the
+	// redacted operation headers. Defaults to util.DefaultRedactor. The
+	// APIKey and the values of secret Headers, e.g. "X-Api-Key", are always
+	// redacted.
+	Redactor *util.Redactor
+}
+
+// redact masks the client secrets and the secrets found by the Redactor in
+// `s`.
+func (c *Client) redact(s string) string {
+	if c.APIKey != "" {
+		s = strings.ReplaceAll(s, c.APIKey, util.Mask)
+	}
+
+	for name, val := range c.Headers {
+		if val != "" && util.IsSecretHeader(name) {
+			s = strings.ReplaceAll(s, val, util.Mask)
+		}
+	}
+
+	if c.Redactor != nil {
+		return c.Redactor.Redact(s)
+	}
+
+	return util.Redact(s)
+}
+
+// redactHeaders returns a redacted copy of `h`.
+func (c *Client) redactHeaders(h http.Header) http.Header {
+	out := make(http.Header, len(h))
+
+	for name, values := range h {
+		redacted := make([]string, len(values))
+
+		for i, v := range values {
+			if util.IsSecretHeader(name) {
+				redacted[i] = util.Mask
+			} else {
+				redacted[i] = c.redact(v)
+			}
+		}
+
+		out[name] = redacted
+	}
+
+	return out
 }
 
 func (c *Client) decode(reader io.ReadCloser, v interface{}) error {
@@ -66,6 +160,25 @@ func (c *Client) decode(reader io.ReadCloser, v interface{}) error {
 	return decodeJSON(reader, v)
 }
 
+// decodeChecked decodes the response, once checked for drift, if `check` is
+// set.
+func (c *Client) decodeChecked(body io.ReadCloser, v interface{}, check driftCheck) error {
+	if check == nil {
+		return c.decode(body, v)
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+
+	if err := check(data, reflect.TypeOf(v), "$"); err != nil {
+		return err
+	}
+
+	return c.decode(io.NopCloser(bytes.NewReader(data)), v)
+}
+
 func (c *Client) encode(writer io.Writer, v interface{}) error {
 	if writer == nil && v != nil {
 		return ErrNullWriter
@@ -78,13 +191,18 @@ func (c *Client) encode(writer io.Writer, v interface{}) error {
 	return encodeJSON(writer, v)
 }
 
-// Execute HTTP request - with context, and return an io.ReadCloser to be
-// decoded. All errors are type (`ClientError`).
-func (c *Client) executeRequest(
-	ctx context.Context,
-	method, url string,
-	request, response interface{},
-) error {
+// Execute HTTP request of `op` - with context, and decode the response. All
+// errors are type (`ClientError`), redacted with the client secrets.
+func (c *Client) send(ctx context.Context, op *Operation) (err error) {
+	defer func() {
+		var cE *ClientError
+		if errors.As(err, &cE) {
+			cE.redact = c.redact
+		}
+	}()
+
+	method, url, request, response := op.Method, op.URL, op.Request, op.Response
+
 	var reader io.Reader
 
 	// Encode request JSON if needed.
@@ -134,6 +252,14 @@ func (c *Client) executeRequest(
 
 	req.SetBasicAuth(c.User, c.APIKey)
 
+	for header, vals := range op.Header {
+		req.Header.Del(header)
+
+		for _, val := range vals {
+			req.Header.Add(header, val)
+		}
+	}
+
 	var resp *http.Response
 	if c.RoundTrip != nil {
 		resp, err = c.RoundTrip(req) //nolint:bodyclose // Closed later
@@ -162,6 +288,8 @@ func (c *Client) executeRequest(
 
 	defer resp.Body.Close()
 
+	op.StatusCode = resp.StatusCode
+
 	// Only 2xx is considered valid.
 	if resp.StatusCode < http.StatusOK ||
 		resp.StatusCode >= http.StatusMultipleChoices {
@@ -171,9 +299,14 @@ func (c *Client) executeRequest(
 		// Note: It's safe to read here - have no Guard, because the http Client
 		// and Transport guarantee that Body is always non-nil, even on
 		// responses without a body or responses with a zero-length body.
+		limit := c.MaxErrorBodySize
+		if limit <= 0 {
+			limit = defaultMaxErrorBodySize
+		}
+
 		buf := new(bytes.Buffer)
 
-		if _, err := buf.ReadFrom(resp.Body); err != nil {
+		if _, err := buf.ReadFrom(io.LimitReader(resp.Body, limit+1)); err != nil {
 			// e.g.: "Failed to read/parse resp.Body/JSON".
 			return &ClientError{
 				Err:        err,
@@ -190,6 +323,11 @@ func (c *Client) executeRequest(
 			URL:        util.SanitizedURL(req.URL),
 		}
 
+		if int64(buf.Len()) > limit {
+			buf.Truncate(int(limit))
+			cE.ServerResponseTruncated = true
+		}
+
 		// Does the server have any information/reason?
 		if buf.String() != "" {
 			cE.ServerResponse = buf.String()
@@ -200,7 +338,30 @@ func (c *Client) executeRequest(
 
 	// Decode response if needed.
 	if response != nil {
-		if err := c.decode(resp.Body, response); err != nil {
+		body := resp.Body
+
+		if c.MaxResponseSize > 0 {
+			if resp.ContentLength > c.MaxResponseSize {
+				return &ClientError{
+					Err:        &ResponseTooLargeError{Limit: c.MaxResponseSize},
+					StatusCode: http.StatusInternalServerError,
+					URL:        util.SanitizedURL(req.URL),
+				}
+			}
+
+			body = &limitedBody{ReadCloser: body, limit: c.MaxResponseSize}
+		}
+
+		check := c.driftCheck(op.Name)
+
+		var err error
+		if d, ok := response.(responseDecoder); ok {
+			err = d.decodeResponse(body, check)
+		} else {
+			err = c.decodeChecked(body, response, check)
+		}
+
+		if err != nil {
 			// Reaching here means that the response was received. However, the server
 			// response still might be not a valid JSON.
 			return &ClientError{
@@ -224,27 +385,37 @@ func (c *Client) getTunnelOwnerUsername() string {
 }
 
 // listSharedTunnels returns tunnel states per user in the org with shared tunnels for given protocols.
-func (c *Client) listSharedTunnels(protocol ...Protocol) (map[string][]TunnelState, error) {
+func (c *Client) listSharedTunnels(ctx context.Context, protocol ...Protocol) (map[string][]TunnelState, error) {
 	states := make(map[string][]TunnelState)
 
 	url := fmt.Sprintf("%s/%s/tunnels?full=1&all=1%s", c.BaseURL, c.getTunnelOwnerUsername(), protocolQuery(protocol))
-	err := c.executeRequest(context.Background(), http.MethodGet, url, nil, &states)
+	err := c.invoke(ctx, &Operation{
+		Name:     OperationListSharedTunnels,
+		Method:   http.MethodGet,
+		URL:      url,
+		Response: &states,
+	})
 
 	return states, err
 }
 
 // listTunnels returns tunnels for a given user for given protocols.
-func (c *Client) listTunnels(protocol ...Protocol) ([]TunnelState, error) {
+func (c *Client) listTunnels(ctx context.Context, protocol ...Protocol) ([]TunnelState, error) {
 	var states []TunnelState
 
 	url := fmt.Sprintf("%s/%s/tunnels?full=1%s", c.BaseURL, c.getTunnelOwnerUsername(), protocolQuery(protocol))
-	err := c.executeRequest(context.Background(), http.MethodGet, url, nil, &states)
+	err := c.invoke(ctx, &Operation{
+		Name:     OperationListTunnels,
+		Method:   http.MethodGet,
+		URL:      url,
+		Response: &states,
+	})
 
 	return states, err
 }
 
 // Returns all the user tunnels (including already terminated ones).
-func (c *Client) listAllTunnels(limit int) (map[string][]TunnelState, error) {
+func (c *Client) listAllTunnels(ctx context.Context, limit int) (map[string][]TunnelState, error) {
 	tunnels := map[string][]TunnelState{}
 	url := fmt.Sprintf("%s/%s/all_tunnels", c.BaseURL, c.getTunnelOwnerUsername())
 
@@ -252,7 +423,12 @@ func (c *Client) listAllTunnels(limit int) (map[string][]TunnelState, error) {
 		url = fmt.Sprintf("%s?limit=%d", url, limit)
 	}
 
-	err := c.executeRequest(context.Background(), http.MethodGet, url, nil, &tunnels)
+	err := c.invoke(ctx, &Operation{
+		Name:     OperationListAllTunnels,
+		Method:   http.MethodGet,
+		URL:      url,
+		Response: &tunnels,
+	})
 
 	return tunnels, err
 }
@@ -261,6 +437,8 @@ func (c *Client) listAllTunnels(limit int) (map[string][]TunnelState, error) {
 // "serverTimeout", etc... `wait` determines whether the control logic should
 // wait for jobs to finish before terminating the tunnel.
 func (c *Client) shutdown(ctx context.Context, id string, reason string, wait bool) (int, error) {
+	start := time.Now()
+
 	u, err := generateURL(
 		fmt.Sprintf("%s/%s/tunnels/%s", c.BaseURL, c.getTunnelOwnerUsername(), id),
 		nil,
@@ -284,20 +462,37 @@ func (c *Client) shutdown(ctx context.Context, id string, reason string, wait bo
 		return -1, err
 	}
 
-	var response struct {
-		JobsRunning int `json:"jobs_running"`
-	}
+	var response ShutdownTunnelResponse
 
-	if err := c.executeRequest(
-		ctx,
-		http.MethodDelete,
-		u,
-		nil,
-		&response,
-	); err != nil {
+	err = c.invoke(ctx, &Operation{
+		Name:     OperationShutdownTunnel,
+		TunnelID: id,
+		Method:   http.MethodDelete,
+		URL:      u,
+		Response: &response,
+	})
+
+	params := struct {
+		Reason string `json:"reason"`
+		Wait   bool   `json:"wait"`
+	}{Reason: reason, Wait: wait}
+
+	auditErr := c.recordAudit(AuditShutdown, id, params, start, err)
+	if err != nil {
 		return 0, err
 	}
 
+	if c.SessionStore != nil {
+		if err := c.SessionStore.Remove(id); err != nil {
+			return response.JobsRunning, err
+		}
+	}
+
+	// The tunnel is shut down, the audit error doesn't hide it.
+	if auditErr != nil {
+		return response.JobsRunning, auditErr
+	}
+
 	return response.JobsRunning, nil
 }
 
@@ -305,10 +500,38 @@ func (c *Client) shutdown(ctx context.Context, id string, reason string, wait bo
 func (c *Client) create(ctx context.Context, req any) (TunnelStateWithMessages, error) {
 	var tunnel TunnelStateWithMessages
 
+	start := time.Now()
 	url := fmt.Sprintf("%s/%s/tunnels", c.BaseURL, c.getTunnelOwnerUsername())
-	err := c.executeRequest(ctx, http.MethodPost, url, req, &tunnel)
+	err := c.invoke(ctx, &Operation{
+		Name:     OperationCreateTunnel,
+		Method:   http.MethodPost,
+		URL:      url,
+		Request:  req,
+		Response: &tunnel,
+	})
+
+	auditErr := c.recordAudit(AuditCreate, tunnel.ID, req, start, err)
+	if err != nil {
+		return tunnel, err
+	}
+
+	// The tunnel is running, and returned along with the error. Messages are
+	// handled even if the session can't be saved, fatal ones take precedence.
+	sessionErr := c.saveSession(tunnel.TunnelState)
+
+	if err := c.handleMessages(MessageSourceCreate, tunnel.Messages); err != nil {
+		return tunnel, err
+	}
+
+	if sessionErr != nil {
+		return tunnel, sessionErr
+	}
+
+	if auditErr != nil {
+		return tunnel, auditErr
+	}
 
-	return tunnel, err
+	return tunnel, nil
 }
 
 // GetSCUpdates retrieves user messages, and the client version/platform
@@ -341,7 +564,16 @@ func (c *Client) GetSCUpdates(
 		return resp, err
 	}
 
-	if err := c.executeRequest(ctx, http.MethodGet, infoURL, nil, &resp); err != nil {
+	if err := c.invoke(ctx, &Operation{
+		Name:     OperationGetSCUpdates,
+		Method:   http.MethodGet,
+		URL:      infoURL,
+		Response: &resp,
+	}); err != nil {
+		return resp, err
+	}
+
+	if err := c.handleMessages(MessageSourceUpdates, resp.SCMessages); err != nil {
 		return resp, err
 	}
 
@@ -377,7 +609,12 @@ func (c *Client) GetVersions(
 		return resp, err
 	}
 
-	if err := c.executeRequest(context.Background(), http.MethodGet, versionsURL, nil, &resp); err != nil {
+	if err := c.invoke(context.Background(), &Operation{
+		Name:     OperationGetVersions,
+		Method:   http.MethodGet,
+		URL:      versionsURL,
+		Response: &resp,
+	}); err != nil {
 		return resp, err
 	}
 
@@ -401,15 +638,25 @@ func (c *Client) UpdateClientStatus(
 		Memory:               memory,
 	}
 
-	if err := c.executeRequest(ctx, http.MethodPost, url, &req, &resp); err != nil {
-		return resp, err
-	}
-
-	return resp, nil
+	start := time.Now()
+	err := c.invoke(ctx, &Operation{
+		Name:     OperationUpdateClientStatus,
+		TunnelID: id,
+		Method:   http.MethodPost,
+		URL:      url,
+		Request:  &req,
+		Response: &resp,
+	})
+
+	return resp, c.audit(AuditUpdateClientStatus, id, req, start, err)
 }
 
 // ReportCrash is used to update Sauce Labs REST API that client crashed.
 func (c *Client) ReportCrash(tunnel, info, logs string) error {
+	return c.reportCrash(context.Background(), tunnel, info, logs)
+}
+
+func (c *Client) reportCrash(ctx context.Context, tunnel, info, logs string) error {
 	doc := struct {
 		Info   string `json:"Info"`
 		Logs   string `json:"Logs"`
@@ -418,7 +665,22 @@ func (c *Client) ReportCrash(tunnel, info, logs string) error {
 
 	url := fmt.Sprintf("%s/%s/errors", c.BaseURL, c.User)
 
-	return c.executeRequest(context.Background(), http.MethodPost, url, doc, nil)
+	start := time.Now()
+	err := c.invoke(ctx, &Operation{
+		Name:     OperationReportCrash,
+		TunnelID: tunnel,
+		Method:   http.MethodPost,
+		URL:      url,
+		Request:  doc,
+	})
+
+	// The logs are too large for the audit log.
+	params := struct {
+		Info     string `json:"info"`
+		LogsSize int    `json:"logs_size"`
+	}{Info: info, LogsSize: len(logs)}
+
+	return c.audit(AuditReportCrash, tunnel, params, start, err)
 }
 
 // TunnelState returns the tunnel `id` information obtained from Sauce Labs REST API.
@@ -426,7 +688,13 @@ func (c *Client) TunnelState(ctx context.Context, id string) (TunnelState, error
 	info := TunnelState{}
 	url := fmt.Sprintf("%s/%s/tunnels/%s", c.BaseURL, c.getTunnelOwnerUsername(), id)
 
-	err := c.executeRequest(ctx, http.MethodGet, url, nil, &info)
+	err := c.invoke(ctx, &Operation{
+		Name:     OperationTunnelState,
+		TunnelID: id,
+		Method:   http.MethodGet,
+		URL:      url,
+		Response: &info,
+	})
 
 	return info, err
 }
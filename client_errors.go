@@ -21,15 +21,27 @@ type ClientError struct {
 	// Message, if provided, will be used instead of the usual message.
 	Message        string
 	ServerResponse string
-	StatusCode     int
-	URL            string
+	// ServerResponseTruncated is set if the server response was longer than
+	// the client MaxErrorBodySize.
+	ServerResponseTruncated bool
+	StatusCode              int
+	URL                     string
+
+	// redact is the redaction of the client that returned the error.
+	redact func(string) string
 }
 
-// Error interface implementation.
+// Error interface implementation. Secrets, e.g. in the server response, are
+// redacted with the client redaction, or util.DefaultRedactor.
 func (cE *ClientError) Error() string {
+	redact := cE.redact
+	if redact == nil {
+		redact = util.Redact
+	}
+
 	// Allows to specify a concise error message.
 	if cE.Message != "" {
-		return cE.Message
+		return redact(cE.Message)
 	}
 
 	errMsg := fmt.Sprintf("URL %s", util.SanitizedRawURL(cE.URL))
@@ -44,9 +56,13 @@ func (cE *ClientError) Error() string {
 
 	if cE.ServerResponse != "" {
 		errMsg = fmt.Sprintf("%s. Server response: %s", errMsg, cE.ServerResponse)
+
+		if cE.ServerResponseTruncated {
+			errMsg += " (truncated)"
+		}
 	}
 
-	return errMsg
+	return redact(errMsg)
 }
 
 // Unwrap interface implementation.
@@ -61,6 +77,17 @@ func (cE *ClientError) Short() string {
 	return fmt.Sprintf("Failed to reach %s", util.SanitizedRawURL(cE.URL))
 }
 
+// ResponseTooLargeError is returned when a response body is larger than the
+// client MaxResponseSize.
+type ResponseTooLargeError struct {
+	Limit int64
+}
+
+// Error interface implementation.
+func (e *ResponseTooLargeError) Error() string {
+	return fmt.Sprintf("response body exceeds the limit of %d bytes", e.Limit)
+}
+
 // MissingRegionsInformation indicates that the response doesn't contain
 // Sauce Labs `regions` information.
 var MissingRegionsInformation = func(url string) *ClientError {
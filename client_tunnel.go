@@ -6,6 +6,7 @@ import (
 )
 
 // CreateTunnelV4 requests Sauce Labs REST API to create a new tunnel.
+// Identifier collisions are handled according to the client CollisionPolicy.
 func (c *Client) CreateTunnelV4(
 	ctx context.Context, req *CreateTunnelRequestV4, timeout time.Duration,
 ) (TunnelStateWithMessages, error) {
@@ -13,10 +14,17 @@ func (c *Client) CreateTunnelV4(
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
+	if req.TunnelIdentifier != nil {
+		if err := c.applyCollisionPolicy(ctx, *req.TunnelIdentifier, &req.TunnelPool); err != nil {
+			return TunnelStateWithMessages{}, err
+		}
+	}
+
 	return c.create(ctx, req)
 }
 
 // CreateTunnelV5 requests Sauce Labs REST API to create a new Sauce Connect 5 tunnel.
+// Identifier collisions are handled according to the client CollisionPolicy.
 func (c *Client) CreateTunnelV5(
 	ctx context.Context, req *CreateTunnelRequestV5, timeout time.Duration,
 ) (TunnelStateWithMessages, error) {
@@ -24,13 +32,21 @@ func (c *Client) CreateTunnelV5(
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
+	if err := c.applyCollisionPolicy(ctx, req.TunnelIdentifier, &req.TunnelPool); err != nil {
+		return TunnelStateWithMessages{}, err
+	}
+
 	return c.create(ctx, req)
 }
 
 // ListAllTunnelStates returns all the tunnels (including not currently running)
 // for a given user.
 func (c *Client) ListAllTunnelStates(limit int) ([]TunnelState, error) {
-	allTunnels, err := c.listAllTunnels(limit)
+	return c.listAllTunnelStates(context.Background(), limit)
+}
+
+func (c *Client) listAllTunnelStates(ctx context.Context, limit int) ([]TunnelState, error) {
+	allTunnels, err := c.listAllTunnels(ctx, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -47,7 +63,7 @@ func (c *Client) ListAllTunnelStates(limit int) ([]TunnelState, error) {
 // ListSharedTunnels returns tunnel IDs per user for a given org with shared tunnels.
 // Filter results by one or more protocol, or leave empty for all protocols.
 func (c *Client) ListSharedTunnels(protocol ...Protocol) (map[string][]string, error) {
-	tunnels, err := c.listSharedTunnels(protocol...)
+	tunnels, err := c.listSharedTunnels(context.Background(), protocol...)
 	if err != nil {
 		return nil, err
 	}
@@ -58,13 +74,13 @@ func (c *Client) ListSharedTunnels(protocol ...Protocol) (map[string][]string, e
 // ListSharedTunnelStates returns tunnels per user for a given org with shared tunnels.
 // Filter results by one or more protocol, or leave empty for all protocols.
 func (c *Client) ListSharedTunnelStates(protocol ...Protocol) (map[string][]TunnelState, error) {
-	return c.listSharedTunnels(protocol...)
+	return c.listSharedTunnels(context.Background(), protocol...)
 }
 
 // ListTunnels returns tunnel IDs for a given user.
 // Filter results by one or more protocol, or leave empty for all protocols.
 func (c *Client) ListTunnels(protocol ...Protocol) ([]string, error) {
-	states, err := c.listTunnels(protocol...)
+	states, err := c.listTunnels(context.Background(), protocol...)
 	if err != nil {
 		return nil, err
 	}
@@ -74,7 +90,7 @@ func (c *Client) ListTunnels(protocol ...Protocol) ([]string, error) {
 
 // ListTunnelStates returns KGP tunnel states for a given user.
 func (c *Client) ListTunnelStates(protocol ...Protocol) ([]TunnelState, error) {
-	return c.listTunnels(protocol...)
+	return c.listTunnels(context.Background(), protocol...)
 }
 
 // ShutdownTunnel terminates tunnel. Termination 'reason' could be
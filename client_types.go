@@ -1,6 +1,7 @@
 package rest
 
 import (
+	"encoding/json"
 	"fmt"
 
 	"github.com/saucelabs/tunnelrest-go/region"
@@ -75,6 +76,9 @@ type ClientStatusRequest struct {
 	Memory               *Memory `json:"memory,omitempty"`
 }
 
+// TunnelStatusTerminated is the TunnelState Status of a shut down tunnel.
+const TunnelStatusTerminated = "terminated"
+
 // TunnelState contains a detailed tunnel information as returned by REST API.
 type TunnelState struct {
 	CreationTime     int      `json:"creation_time"`
@@ -92,6 +96,21 @@ type TunnelState struct {
 	Status           string   `json:"status"`
 	TunnelIdentifier string   `json:"tunnel_identifier"`
 	UserShutdown     *bool    `json:"user_shutdown,omitempty"`
+
+	Protocol Protocol `json:"protocol,omitempty"`
+	Region   string   `json:"region,omitempty"`
+	// LaunchTime and LastConnected, the time of the last client status
+	// update, are Unix timestamps, like CreationTime.
+	LaunchTime       int      `json:"launch_time,omitempty"`
+	LastConnected    int      `json:"last_connected,omitempty"`
+	DomainNames      []string `json:"domain_names,omitempty"`
+	DirectDomains    []string `json:"direct_domains,omitempty"`
+	NoSSLBumpDomains []string `json:"no_ssl_bump_domains,omitempty"`
+	TunnelPool       bool     `json:"tunnel_pool,omitempty"`
+
+	// Extra are the response fields unknown to the type, as raw JSON. They're
+	// encoded back by MarshalJSON.
+	Extra map[string]json.RawMessage `json:"-"`
 }
 
 type TunnelStateWithMessages struct {
@@ -105,7 +124,14 @@ type UpdateClientStatusResponse struct {
 	Result bool   `json:"result"`
 }
 
-// ClientConfiguration definition.
+// ShutdownTunnelResponse is the REST API response.
+type ShutdownTunnelResponse struct {
+	JobsRunning int `json:"jobs_running"`
+}
+
+// ClientConfiguration definition. Timeouts and intervals are in seconds, use
+// the time.Duration accessors, e.g. JobWait. Zero values are unset, the
+// accessors return DefaultClientConfiguration values instead.
 type ClientConfiguration struct {
 	Experimental         []string        `json:"experimental,omitempty"`
 	JobWaitTimeout       int             `json:"job_wait_timeout,omitempty"`
@@ -132,6 +158,9 @@ type SCMessages struct {
 type SCUpdates struct {
 	SCMessages
 	Configuration ClientConfiguration `json:"configuration"`
+
+	// Extra are the response fields unknown to the type, see TunnelState.
+	Extra map[string]json.RawMessage `json:"-"`
 }
 
 // ClientDownloadInfo contains a SC client download info.
@@ -159,6 +188,9 @@ type SCVersions struct {
 	Warning       []string                      `json:"warning,omitempty"`
 	Downloads     DownloadByPlatform            `json:"downloads"`
 	AllDownloads  map[string]DownloadByPlatform `json:"all_downloads,omitempty"`
+
+	// Extra are the response fields unknown to the type, see TunnelState.
+	Extra map[string]json.RawMessage `json:"-"`
 }
 
 func (m Memory) String() string {
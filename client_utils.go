@@ -21,6 +21,36 @@ func decodeJSON(reader io.ReadCloser, v interface{}) error {
 	return nil
 }
 
+// limitedBody fails with a *ResponseTooLargeError once more than `limit`
+// bytes are read.
+type limitedBody struct {
+	io.ReadCloser
+	limit, read int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.read >= b.limit {
+		// Probe for more data past the limit.
+		var probe [1]byte
+
+		n, err := b.ReadCloser.Read(probe[:])
+		if n > 0 {
+			return 0, &ResponseTooLargeError{Limit: b.limit}
+		}
+
+		return 0, err
+	}
+
+	if left := b.limit - b.read; int64(len(p)) > left {
+		p = p[:left]
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+
+	return n, err
+}
+
 func encodeJSON(w io.Writer, v interface{}) error {
 	if err := json.NewEncoder(w).Encode(v); err != nil {
 		return fmt.Errorf("couldn't encode JSON document: %w", err)
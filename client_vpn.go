@@ -18,7 +18,7 @@ func (c *Client) CreateVPNProxy(
 
 // ListVPNProxies returns VPN proxy IDs for a given user.
 func (c *Client) ListVPNProxies() ([]string, error) {
-	states, err := c.listTunnels(VPNProtocol)
+	states, err := c.listTunnels(context.Background(), VPNProtocol)
 	if err != nil {
 		return nil, err
 	}
@@ -28,12 +28,12 @@ func (c *Client) ListVPNProxies() ([]string, error) {
 
 // ListVPNStates returns VPN proxy states for a given user.
 func (c *Client) ListVPNStates() ([]TunnelState, error) {
-	return c.listTunnels(VPNProtocol)
+	return c.listTunnels(context.Background(), VPNProtocol)
 }
 
 // ListSharedVPNs returns proxy IDs per user for a given org with shared proxies.
 func (c *Client) ListSharedVPNs() (map[string][]string, error) {
-	tunnels, err := c.listSharedTunnels(VPNProtocol)
+	tunnels, err := c.listSharedTunnels(context.Background(), VPNProtocol)
 	if err != nil {
 		return nil, err
 	}
@@ -43,7 +43,7 @@ func (c *Client) ListSharedVPNs() (map[string][]string, error) {
 
 // ListSharedVPNStates returns VPN proxy states per user for a given org with shared proxies.
 func (c *Client) ListSharedVPNStates() (map[string][]TunnelState, error) {
-	return c.listSharedTunnels(VPNProtocol)
+	return c.listSharedTunnels(context.Background(), VPNProtocol)
 }
 
 // ShutdownVPNProxy terminates VPN proxy.
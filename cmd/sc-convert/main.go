@@ -0,0 +1,167 @@
+// Command sc-convert rewrites Sauce Connect 4 tunnel requests stored as JSON
+// files into Sauce Connect 5 tunnel requests.
+//
+// Usage:
+//
+//	sc-convert [-w] [-strict] path...
+//
+// Every path is either a JSON file or a directory that is searched
+// recursively for "*.json" files. Files that aren't Sauce Connect 4 tunnel
+// requests, e.g. package.json or already converted requests, are skipped in
+// directories, and fail if given explicitly. By default the converted request
+// is printed to stdout, -w rewrites the files in place. Lossy conversions are
+// reported to stderr, -strict makes them fatal.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	rest "github.com/saucelabs/tunnelrest-go"
+)
+
+var (
+	errLossy = errors.New("lossy conversion")
+	errNotV4 = errors.New("not a Sauce Connect 4 tunnel request")
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("sc-convert", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+
+	write := flags.Bool("w", false, "rewrite files in place instead of printing to stdout")
+	strict := flags.Bool("strict", false, "fail on lossy conversions, files are left untouched")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() == 0 {
+		fmt.Fprintln(stderr, "usage: sc-convert [-w] [-strict] path...")
+
+		return 2
+	}
+
+	failed := false
+
+	for _, root := range flags.Args() {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if d.IsDir() || (path != root && filepath.Ext(path) != ".json") {
+				return nil
+			}
+
+			err = convertFile(path, *write, *strict, stdout, stderr)
+
+			switch {
+			case err == nil:
+			case errors.Is(err, errNotV4) && path != root:
+				fmt.Fprintf(stderr, "%s: skipped, %v\n", path, err)
+			default:
+				fmt.Fprintf(stderr, "%s: %v\n", path, err)
+
+				failed = true
+			}
+
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+
+			failed = true
+		}
+	}
+
+	if failed {
+		return 1
+	}
+
+	return 0
+}
+
+// decodeV4 decodes a Sauce Connect 4 tunnel request. Unknown fields, e.g.
+// Sauce Connect 5 ones, and requests already using another protocol are
+// rejected, so that they aren't overwritten by a lossy conversion.
+func decodeV4(data []byte) (*rest.CreateTunnelRequestV4, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil || len(fields) == 0 {
+		return nil, errNotV4
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	var req rest.CreateTunnelRequestV4
+	if err := dec.Decode(&req); err != nil {
+		return nil, fmt.Errorf("%w: %v", errNotV4, err)
+	}
+
+	if req.Protocol != "" && req.Protocol != string(rest.KGPProtocol) {
+		return nil, fmt.Errorf("%w: protocol is %q", errNotV4, req.Protocol)
+	}
+
+	return &req, nil
+}
+
+func convertFile(path string, write, strict bool, stdout, stderr io.Writer) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	req, err := decodeV4(data)
+	if err != nil {
+		return err
+	}
+
+	out, report := rest.ConvertV4ToV5(req)
+
+	for _, issue := range report.Issues {
+		fmt.Fprintf(stderr, "%s: %s\n", path, issue)
+	}
+
+	if strict && report.Lossy() {
+		return errLossy
+	}
+
+	var buf bytes.Buffer
+
+	enc := json.NewEncoder(&buf)
+	enc.SetIndent("", "  ")
+
+	if err := enc.Encode(out); err != nil {
+		return err
+	}
+
+	if !write {
+		_, err = stdout.Write(buf.Bytes())
+
+		return err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), info.Mode().Perm()); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	v4Request = `{"tunnel_identifier":"my-tunnel","shared_tunnel":false,"tunnel_pool":false,` +
+		`"no_proxy_caching":false,"ssh_port":0,"domain_names":["sauce-connect.proxy"],` +
+		`"fast_fail_regexps":["^https?://example\\.com/.*"],"metadata":{}}`
+	lossyV4Request = `{"tunnel_identifier":"my-tunnel","fast_fail_regexps":["example\\.com"]}`
+	v5Request      = `{"tunnel_identifier":"my-tunnel","protocol":"h2c","shared":"",` +
+		`"tunnel_domains":["sauce-connect.proxy"]}`
+	packageJSON = `{"name":"my-app","version":"1.0.0"}`
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(b)
+}
+
+func TestRunWriteSkipsNonV4Files(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"tunnel.json":  v4Request,
+		"v5.json":      v5Request,
+		"package.json": packageJSON,
+		"empty.json":   `{}`,
+	})
+
+	var stdout, stderr bytes.Buffer
+
+	code := run([]string{"-w", dir}, &stdout, &stderr)
+	assert.Equal(t, 0, code, stderr.String())
+	assert.Empty(t, stdout.String())
+
+	converted := readFile(t, filepath.Join(dir, "tunnel.json"))
+	assert.Contains(t, converted, `"protocol": "h2c"`)
+	assert.Contains(t, converted, `"deny_domains": [`)
+	assert.Contains(t, converted, `"example.com"`)
+
+	assert.Equal(t, v5Request, readFile(t, filepath.Join(dir, "v5.json")))
+	assert.Equal(t, packageJSON, readFile(t, filepath.Join(dir, "package.json")))
+	assert.Equal(t, `{}`, readFile(t, filepath.Join(dir, "empty.json")))
+
+	assert.Contains(t, stderr.String(), "v5.json: skipped")
+	assert.Contains(t, stderr.String(), "package.json: skipped")
+	assert.Contains(t, stderr.String(), "empty.json: skipped")
+}
+
+func TestRunExplicitNonV4FileFails(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"package.json": packageJSON})
+	path := filepath.Join(dir, "package.json")
+
+	var stdout, stderr bytes.Buffer
+
+	assert.Equal(t, 1, run([]string{"-w", path}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), errNotV4.Error())
+	assert.Equal(t, packageJSON, readFile(t, path))
+}
+
+func TestRunStrictLeavesLossyFile(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"tunnel.json": lossyV4Request})
+	path := filepath.Join(dir, "tunnel.json")
+
+	var stdout, stderr bytes.Buffer
+
+	assert.Equal(t, 1, run([]string{"-w", "-strict", path}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), `fast_fail_regexps "example\\.com"`)
+	assert.Contains(t, stderr.String(), errLossy.Error())
+	assert.Equal(t, lossyV4Request, readFile(t, path))
+}
+
+func TestRunPrintsToStdout(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"tunnel.json": v4Request})
+	path := filepath.Join(dir, "tunnel.json")
+
+	var stdout, stderr bytes.Buffer
+
+	assert.Equal(t, 0, run([]string{path}, &stdout, &stderr))
+	assert.Contains(t, stdout.String(), `"tunnel_identifier": "my-tunnel"`)
+	assert.Equal(t, v4Request, readFile(t, path))
+}
+
+func TestRunUsage(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	assert.Equal(t, 2, run(nil, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "usage:")
+}
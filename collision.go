@@ -0,0 +1,133 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// CollisionShutdownReason is sent when a tunnel is shut down by the
+// CollisionReplace policy.
+const CollisionShutdownReason = "identifier_collision"
+
+// CollisionPolicy defines what happens when a tunnel is created with the
+// identifier of an already running tunnel.
+type CollisionPolicy int
+
+const (
+	// CollisionIgnore doesn't check for collisions.
+	CollisionIgnore CollisionPolicy = iota
+	// CollisionFail fails the creation with a TunnelCollisionError.
+	CollisionFail
+	// CollisionReplace shuts down the running tunnels first. Tunnels shared
+	// by other users can't be shut down, and fail the creation.
+	CollisionReplace
+	// CollisionJoinPool creates the tunnel as a member of a tunnel pool.
+	CollisionJoinPool
+)
+
+// String interface implementation.
+func (p CollisionPolicy) String() string {
+	switch p {
+	case CollisionIgnore:
+		return "ignore"
+	case CollisionFail:
+		return "fail"
+	case CollisionReplace:
+		return "replace"
+	case CollisionJoinPool:
+		return "join-pool"
+	default:
+		return fmt.Sprintf("CollisionPolicy(%d)", int(p))
+	}
+}
+
+// TunnelCollisionError is returned when a tunnel identifier is already used
+// by running tunnels.
+type TunnelCollisionError struct {
+	Identifier string
+	Existing   []TunnelState
+}
+
+// Error interface implementation.
+func (e *TunnelCollisionError) Error() string {
+	tunnels := make([]string, len(e.Existing))
+	for i, s := range e.Existing {
+		tunnels[i] = fmt.Sprintf("%s (owner %s, host %s)", s.ID, s.Owner, s.Host)
+	}
+
+	return fmt.Sprintf("tunnel identifier %q is already used by %s", e.Identifier, strings.Join(tunnels, ", "))
+}
+
+// applyCollisionPolicy checks for running tunnels with `identifier`, and
+// applies the client policy. Requests already flagged as tunnel pool members
+// are expected to share the identifier, and aren't checked.
+func (c *Client) applyCollisionPolicy(ctx context.Context, identifier string, tunnelPool *bool) error {
+	if c.CollisionPolicy == CollisionIgnore || identifier == "" || *tunnelPool {
+		return nil
+	}
+
+	own, shared, err := c.runningTunnels(ctx, identifier)
+	if err != nil {
+		return err
+	}
+
+	if len(own)+len(shared) == 0 {
+		return nil
+	}
+
+	switch c.CollisionPolicy {
+	case CollisionJoinPool:
+		*tunnelPool = true
+
+		return nil
+	case CollisionReplace:
+		if len(shared) > 0 {
+			return &TunnelCollisionError{Identifier: identifier, Existing: shared}
+		}
+
+		for _, s := range own {
+			if _, err := c.shutdown(ctx, s.ID, CollisionShutdownReason, false); err != nil && !isNotFound(err) {
+				return err
+			}
+		}
+
+		return nil
+	default:
+		return &TunnelCollisionError{Identifier: identifier, Existing: append(own, shared...)}
+	}
+}
+
+// runningTunnels returns the running tunnels with `identifier`, owned by the
+// tunnel owner and shared by other users of the org.
+func (c *Client) runningTunnels(ctx context.Context, identifier string) (own, shared []TunnelState, err error) {
+	states, err := c.listTunnels(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	seen := make(map[string]bool)
+
+	for _, s := range states {
+		if s.TunnelIdentifier == identifier && !isTerminated(s) {
+			own = append(own, s)
+			seen[s.ID] = true
+		}
+	}
+
+	sharedStates, err := c.listSharedTunnels(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, userStates := range sharedStates {
+		for _, s := range userStates {
+			if s.TunnelIdentifier == identifier && !isTerminated(s) && !seen[s.ID] {
+				shared = append(shared, s)
+				seen[s.ID] = true
+			}
+		}
+	}
+
+	return own, shared, nil
+}
@@ -0,0 +1,75 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	assertLib "github.com/stretchr/testify/assert"
+)
+
+func TestCollisionPolicy(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      CollisionPolicy
+		wantErr     bool
+		wantRunning int
+		wantPool    bool
+	}{
+		{name: "ignore", policy: CollisionIgnore, wantRunning: 2},
+		{name: "fail", policy: CollisionFail, wantErr: true, wantRunning: 1},
+		{name: "replace", policy: CollisionReplace, wantRunning: 1},
+		{name: "join pool", policy: CollisionJoinPool, wantRunning: 2, wantPool: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert := assertLib.New(t)
+			api, server := newFakeTunnelAPI()
+			defer server.Close()
+
+			client := &Client{BaseURL: server.URL, User: tunnelUser, APIKey: "password"}
+
+			existing, err := client.CreateTunnelV5(context.Background(),
+				&CreateTunnelRequestV5{TunnelIdentifier: "ci"}, time.Second)
+			assert.NoError(err)
+
+			client.CollisionPolicy = tt.policy
+			req := &CreateTunnelRequestV5{TunnelIdentifier: "ci"}
+			_, err = client.CreateTunnelV5(context.Background(), req, time.Second)
+
+			if tt.wantErr {
+				var collision *TunnelCollisionError
+				assert.True(errors.As(err, &collision), "TunnelCollisionError is expected, got %v", err)
+				assert.Equal(existing.ID, collision.Existing[0].ID)
+				assert.Contains(err.Error(), existing.ID)
+			} else {
+				assert.NoError(err)
+			}
+
+			assert.Equal(tt.wantRunning, api.running())
+			assert.Equal(tt.wantPool, req.TunnelPool)
+
+			state, err := client.TunnelState(context.Background(), existing.ID)
+			assert.NoError(err)
+			if tt.policy == CollisionReplace {
+				assert.Equal(CollisionShutdownReason, state.ShutdownReason)
+			}
+		})
+	}
+}
+
+func TestCollisionPolicyNoCollision(t *testing.T) {
+	assert := assertLib.New(t)
+	api, server := newFakeTunnelAPI()
+	defer server.Close()
+
+	client := &Client{BaseURL: server.URL, User: tunnelUser, CollisionPolicy: CollisionFail}
+
+	identifier := "ci"
+	_, err := client.CreateTunnelV4(context.Background(),
+		&CreateTunnelRequestV4{TunnelIdentifier: &identifier}, time.Second)
+	assert.NoError(err)
+	assert.Equal(1, api.running())
+}
@@ -0,0 +1,251 @@
+// Package config loads Sauce Connect REST API client and tunnel settings from
+// YAML or JSON files, environment variables and explicit overrides.
+//
+// A config file looks like:
+//
+//	include:
+//	  - base.yaml
+//	profile: eu
+//	client:
+//	  region: us-west-1
+//	  user: bob
+//	  api_key: xxx
+//	tunnel:
+//	  tunnel_identifier: my-tunnel
+//	  tunnel_domains: [example.com]
+//	profiles:
+//	  eu:
+//	    client:
+//	      region: eu-central-1
+//
+// Settings are applied in the following order, later ones taking precedence:
+//
+//  1. Files, in the order given. Included files are applied before the file
+//     that includes them.
+//  2. The selected profile, from every file, in the same order.
+//  3. Environment variables, see EnvVars.
+//  4. Explicit overrides.
+//
+// Scalars and maps replace earlier values, lists are replaced as a whole.
+//
+// Native Sauce Connect 4 and 5 config files and command lines are parsed with
+// ParseSC4File, ParseSC4Args, ParseSC5File and ParseSC5Args.
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	rest "github.com/saucelabs/tunnelrest-go"
+	"github.com/saucelabs/tunnelrest-go/region"
+)
+
+// ClientSettings are the REST API client settings.
+type ClientSettings struct {
+	// Region is a Sauce Labs region name, e.g. "eu-central-1". Ignored if
+	// BaseURL is set.
+	Region      *string           `yaml:"region"`
+	BaseURL     *string           `yaml:"base_url"`
+	User        *string           `yaml:"user"`
+	APIKey      *string           `yaml:"api_key"`
+	TunnelOwner *string           `yaml:"tunnel_owner"`
+	UserAgent   *string           `yaml:"user_agent"`
+	Headers     map[string]string `yaml:"headers"`
+	// Experimental are local feature gate overrides, applied on top of the
+	// server provided ones, see rest.FeatureGates.
+	Experimental []string `yaml:"experimental"`
+}
+
+// TunnelSettings are the Sauce Connect 5 tunnel settings.
+type TunnelSettings struct {
+	TunnelIdentifier      *string  `yaml:"tunnel_identifier"`
+	Shared                *string  `yaml:"shared"`
+	TunnelPool            *bool    `yaml:"tunnel_pool"`
+	TunnelDomains         []string `yaml:"tunnel_domains"`
+	DirectDomains         []string `yaml:"direct_domains"`
+	DenyDomains           []string `yaml:"deny_domains"`
+	TLSResignDomains      []string `yaml:"tls_resign_domains"`
+	TLSPassthroughDomains []string `yaml:"tls_passthrough_domains"`
+}
+
+// Settings are the client and tunnel settings. Nil fields are unset.
+type Settings struct {
+	Client ClientSettings `yaml:"client"`
+	Tunnel TunnelSettings `yaml:"tunnel"`
+}
+
+// Origin is where a setting comes from.
+type Origin struct {
+	// File is the config file path, or a description such as
+	// "env SAUCE_USERNAME".
+	File string
+	// Line in the file, 0 if not applicable.
+	Line int
+}
+
+// String interface implementation.
+func (o Origin) String() string {
+	if o.Line > 0 {
+		return fmt.Sprintf("%s:%d", o.File, o.Line)
+	}
+
+	return o.File
+}
+
+// Config is the result of loading settings.
+type Config struct {
+	Settings
+	// Profile is the selected profile, if any.
+	Profile string
+
+	origins map[string]Origin
+}
+
+// Origin returns where the setting `key`, e.g. "client.user", comes from.
+func (c *Config) Origin(key string) (Origin, bool) {
+	o, ok := c.origins[key]
+
+	return o, ok
+}
+
+// Validate checks the settings. All the problems are reported at once.
+func (c *Config) Validate() error {
+	var errs Errors
+
+	fail := func(key, format string, args ...interface{}) {
+		errs = append(errs, &Error{Origin: c.origins[key], Key: key, Msg: fmt.Sprintf(format, args...)})
+	}
+
+	if isEmpty(c.Client.User) {
+		fail("client.user", "is required")
+	}
+
+	if isEmpty(c.Client.APIKey) {
+		fail("client.api_key", "is required")
+	}
+
+	switch {
+	case !isEmpty(c.Client.BaseURL):
+		if u, err := url.Parse(*c.Client.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fail("client.base_url", "%q is not an http(s) URL", *c.Client.BaseURL)
+		}
+	case !isEmpty(c.Client.Region):
+		if _, err := region.Lookup(*c.Client.Region); err != nil {
+			fail("client.region", "%v", err)
+		}
+	default:
+		fail("client.region", "either client.region or client.base_url is required")
+	}
+
+	if c.Tunnel.Shared != nil && *c.Tunnel.Shared != "" && *c.Tunnel.Shared != "all" {
+		fail("tunnel.shared", `%q is not supported, the only allowed value is "all"`, *c.Tunnel.Shared)
+	}
+
+	for key, domains := range map[string][]string{
+		"tunnel.tunnel_domains":          c.Tunnel.TunnelDomains,
+		"tunnel.direct_domains":          c.Tunnel.DirectDomains,
+		"tunnel.deny_domains":            c.Tunnel.DenyDomains,
+		"tunnel.tls_resign_domains":      c.Tunnel.TLSResignDomains,
+		"tunnel.tls_passthrough_domains": c.Tunnel.TLSPassthroughDomains,
+	} {
+		for _, d := range domains {
+			if strings.TrimSpace(d) == "" || strings.ContainsAny(d, " /") {
+				fail(key, "%q is not a valid domain", d)
+			}
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Key < errs[j].Key })
+
+	return errs
+}
+
+// BaseURL returns the REST API URL, from the base URL or the region.
+func (c *Config) BaseURL() (string, error) {
+	if !isEmpty(c.Client.BaseURL) {
+		return *c.Client.BaseURL, nil
+	}
+
+	r, err := region.Lookup(value(c.Client.Region))
+	if err != nil {
+		return "", err
+	}
+
+	return r.URL, nil
+}
+
+// NewClient returns a REST API client for the validated settings.
+func (c *Config) NewClient() (*rest.Client, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	baseURL, err := c.BaseURL()
+	if err != nil {
+		return nil, err
+	}
+
+	client := &rest.Client{
+		BaseURL:     baseURL,
+		User:        value(c.Client.User),
+		APIKey:      value(c.Client.APIKey),
+		TunnelOwner: value(c.Client.TunnelOwner),
+		UserAgent:   value(c.Client.UserAgent),
+	}
+
+	if len(c.Client.Headers) > 0 {
+		client.Headers = make(map[string]string, len(c.Client.Headers))
+		for k, v := range c.Client.Headers {
+			client.Headers[k] = v
+		}
+	}
+
+	return client, nil
+}
+
+// FeatureGates returns the server provided feature gates of `server`, with the
+// local Experimental overrides applied.
+func (c *Config) FeatureGates(server rest.ClientConfiguration) rest.FeatureGates {
+	return server.FeatureGates().Override(c.Client.Experimental...)
+}
+
+// TunnelRequest returns the Sauce Connect 5 tunnel request, using the h2c
+// protocol as rest.ConvertV4ToV5 does.
+func (c *Config) TunnelRequest() *rest.CreateTunnelRequestV5 {
+	req := &rest.CreateTunnelRequestV5{
+		TunnelIdentifier:      value(c.Tunnel.TunnelIdentifier),
+		Protocol:              string(rest.H2CProtocol),
+		Shared:                value(c.Tunnel.Shared),
+		TunnelDomains:         c.Tunnel.TunnelDomains,
+		DirectDomains:         c.Tunnel.DirectDomains,
+		DenyDomains:           c.Tunnel.DenyDomains,
+		TLSResignDomains:      c.Tunnel.TLSResignDomains,
+		TLSPassthroughDomains: c.Tunnel.TLSPassthroughDomains,
+	}
+
+	req.SharedTunnel = req.Shared != ""
+
+	if c.Tunnel.TunnelPool != nil {
+		req.TunnelPool = *c.Tunnel.TunnelPool
+	}
+
+	return req
+}
+
+func isEmpty(s *string) bool {
+	return s == nil || strings.TrimSpace(*s) == ""
+}
+
+func value(s *string) string {
+	if s == nil {
+		return ""
+	}
+
+	return *s
+}
@@ -0,0 +1,167 @@
+package config
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	rest "github.com/saucelabs/tunnelrest-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		v, ok := vars[name]
+		return v, ok
+	}
+}
+
+func testdata(name string) string {
+	return filepath.Join("testdata", name)
+}
+
+func TestLoad(t *testing.T) {
+	l := &Loader{LookupEnv: env(nil)}
+
+	cfg, err := l.Load(testdata("app.yaml"))
+	assert.NoError(t, err)
+	assert.Equal(t, "ci", cfg.Profile)
+
+	client, err := cfg.NewClient()
+	assert.NoError(t, err)
+	assert.Equal(t, "https://api.us-west-1.saucelabs.com/rest/v1", client.BaseURL)
+	assert.Equal(t, "bob", client.User)
+	assert.Equal(t, "from-file", client.APIKey)
+	assert.Equal(t, map[string]string{"X-Team": "grid"}, client.Headers)
+
+	req := cfg.TunnelRequest()
+	assert.Equal(t, "app", req.TunnelIdentifier)
+	assert.Equal(t, string(rest.H2CProtocol), req.Protocol)
+	assert.Equal(t, []string{"app.example.com"}, req.TunnelDomains)
+	assert.True(t, req.TunnelPool)
+
+	origin, ok := cfg.Origin("client.user")
+	assert.True(t, ok)
+	assert.Equal(t, testdata("base.yaml")+":3", origin.String())
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	pool := false
+	identifier := "override"
+
+	l := &Loader{
+		Profile: "eu",
+		LookupEnv: env(map[string]string{
+			"SAUCE_PROFILE":      "ci",
+			"SAUCE_ACCESS_KEY":   "from-env",
+			"SAUCE_TUNNEL_NAME":  "from-env",
+			"SAUCE_DENY_DOMAINS": "a.com, b.com",
+		}),
+		Overrides: Settings{
+			Tunnel: TunnelSettings{TunnelIdentifier: &identifier, TunnelPool: &pool},
+		},
+	}
+
+	cfg, err := l.Load(testdata("app.yaml"))
+	assert.NoError(t, err)
+	assert.Equal(t, "eu", cfg.Profile)
+	assert.Equal(t, "eu-central-1", *cfg.Client.Region)
+	assert.Equal(t, "from-env", *cfg.Client.APIKey)
+	assert.Equal(t, []string{"a.com", "b.com"}, cfg.Tunnel.DenyDomains)
+	assert.Equal(t, "override", *cfg.Tunnel.TunnelIdentifier)
+	assert.False(t, *cfg.Tunnel.TunnelPool)
+
+	origin, _ := cfg.Origin("client.api_key")
+	assert.Equal(t, "env SAUCE_ACCESS_KEY", origin.String())
+
+	origin, _ = cfg.Origin("client.region")
+	assert.Equal(t, testdata("app.yaml")+":14", origin.String())
+}
+
+func TestLoadJSON(t *testing.T) {
+	cfg, err := (&Loader{LookupEnv: env(nil)}).Load(testdata("app.json"))
+	assert.NoError(t, err)
+
+	client, err := cfg.NewClient()
+	assert.NoError(t, err)
+	assert.Equal(t, "https://api.example.com/rest/v1", client.BaseURL)
+
+	req := cfg.TunnelRequest()
+	assert.Equal(t, "all", req.Shared)
+	assert.True(t, req.SharedTunnel)
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		profile string
+		want    string
+	}{
+		{
+			name: "invalid type",
+			file: "bad_type.yaml",
+			want: testdata("bad_type.yaml") + ":4: tunnel.tunnel_pool: invalid value, expected boolean",
+		},
+		{
+			name: "unknown key",
+			file: "bad_key.yaml",
+			want: testdata("bad_key.yaml") + ":3: client.passwrd: unknown setting",
+		},
+		{
+			name: "validation",
+			file: "invalid.yaml",
+			want: testdata("invalid.yaml") + `:4: client.region: Unknown "eu-centrl". Did you meant "eu-central-1" @ "https://api.eu-central-1.saucelabs.com/rest/v1"?` +
+				` Available: "us-west-1", "us-east-4", "eu-central-1", "apac-southeast-1"` + "\n" +
+				testdata("invalid.yaml") + `:6: tunnel.shared: "team" is not supported, the only allowed value is "all"`,
+		},
+		{
+			name:    "unknown profile",
+			file:    "app.yaml",
+			profile: "staging",
+			want:    `override: profile: unknown profile "staging"`,
+		},
+		{
+			name: "missing settings",
+			file: "base.yaml",
+			want: "client.api_key: is required",
+		},
+		{
+			name: "include cycle",
+			file: "cycle_a.yaml",
+			want: testdata("cycle_a.yaml") + ": include cycle",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := (&Loader{Profile: tt.profile, LookupEnv: env(nil)}).Load(testdata(tt.file))
+			assert.EqualError(t, err, tt.want)
+
+			var cfgErr *Error
+			var cfgErrs Errors
+			assert.True(t, errors.As(err, &cfgErr) || errors.As(err, &cfgErrs))
+		})
+	}
+}
+
+func TestFeatureGates(t *testing.T) {
+	cfg, err := (&Loader{LookupEnv: env(nil)}).Load(testdata("app.yaml"))
+	assert.NoError(t, err)
+
+	server := rest.ClientConfiguration{Experimental: []string{"http2", "proxy", "dns=8.8.8.8"}}
+
+	gates := cfg.FeatureGates(server)
+	assert.False(t, gates.Enabled("http2"))
+	assert.True(t, gates.Enabled("proxy"))
+
+	dns, _ := gates.Value("dns")
+	assert.Equal(t, "1.1.1.1", dns)
+
+	cfg, err = (&Loader{LookupEnv: env(map[string]string{"SAUCE_EXPERIMENTAL": "-proxy"})}).Load(testdata("app.yaml"))
+	assert.NoError(t, err)
+
+	gates = cfg.FeatureGates(server)
+	assert.True(t, gates.Enabled("http2"))
+	assert.False(t, gates.Enabled("proxy"))
+}
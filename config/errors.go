@@ -0,0 +1,41 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Error is a config error, pointing to the offending setting.
+type Error struct {
+	Origin Origin
+	// Key is the setting, e.g. "client.user", if any.
+	Key string
+	Msg string
+}
+
+// Error interface implementation.
+func (e *Error) Error() string {
+	msg := e.Msg
+	if e.Key != "" {
+		msg = fmt.Sprintf("%s: %s", e.Key, msg)
+	}
+
+	if e.Origin.File != "" {
+		msg = fmt.Sprintf("%s: %s", e.Origin, msg)
+	}
+
+	return msg
+}
+
+// Errors is a list of config errors.
+type Errors []*Error
+
+// Error interface implementation.
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+
+	return strings.Join(msgs, "\n")
+}
@@ -0,0 +1,427 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ProfileEnvVar selects the profile, unless Loader.Profile is set.
+const ProfileEnvVar = "SAUCE_PROFILE"
+
+// EnvVars maps environment variables to settings. List values are comma
+// separated, map values are comma separated "key=value" pairs.
+var EnvVars = map[string]string{
+	"SAUCE_USERNAME":                "client.user",
+	"SAUCE_ACCESS_KEY":              "client.api_key",
+	"SAUCE_REGION":                  "client.region",
+	"SAUCE_API_URL":                 "client.base_url",
+	"SAUCE_TUNNEL_OWNER":            "client.tunnel_owner",
+	"SAUCE_EXPERIMENTAL":            "client.experimental",
+	"SAUCE_TUNNEL_NAME":             "tunnel.tunnel_identifier",
+	"SAUCE_TUNNEL_POOL":             "tunnel.tunnel_pool",
+	"SAUCE_SHARED":                  "tunnel.shared",
+	"SAUCE_TUNNEL_DOMAINS":          "tunnel.tunnel_domains",
+	"SAUCE_DIRECT_DOMAINS":          "tunnel.direct_domains",
+	"SAUCE_DENY_DOMAINS":            "tunnel.deny_domains",
+	"SAUCE_TLS_RESIGN_DOMAINS":      "tunnel.tls_resign_domains",
+	"SAUCE_TLS_PASSTHROUGH_DOMAINS": "tunnel.tls_passthrough_domains",
+}
+
+// Loader loads and validates settings.
+type Loader struct {
+	// Profile selects a profile, it takes precedence over the
+	// ProfileEnvVar environment variable and the "profile" key in files.
+	Profile string
+	// LookupEnv looks up environment variables. Defaults to os.LookupEnv.
+	LookupEnv func(string) (string, bool)
+	// Overrides are applied last.
+	Overrides Settings
+}
+
+// Load loads `paths` with the default Loader.
+func Load(paths ...string) (*Config, error) {
+	return (&Loader{}).Load(paths...)
+}
+
+// Load loads `paths`, applies the selected profile, the environment and the
+// overrides, and validates the result.
+func (l *Loader) Load(paths ...string) (*Config, error) {
+	lookupEnv := l.LookupEnv
+	if lookupEnv == nil {
+		lookupEnv = os.LookupEnv
+	}
+
+	cfg := &Config{origins: make(map[string]Origin)}
+
+	var docs []*document
+
+	for _, path := range paths {
+		d, err := parseFile(path, map[string]bool{})
+		if err != nil {
+			return nil, err
+		}
+
+		docs = append(docs, d...)
+	}
+
+	var profileOrigin Origin
+
+	for _, d := range docs {
+		for _, s := range d.sections {
+			if err := cfg.applyNode(s.name, s.node, d.path); err != nil {
+				return nil, err
+			}
+		}
+
+		if d.profile != "" {
+			cfg.Profile, profileOrigin = d.profile, d.profileOrigin
+		}
+	}
+
+	if v, ok := lookupEnv(ProfileEnvVar); ok && v != "" {
+		cfg.Profile, profileOrigin = v, Origin{File: "env " + ProfileEnvVar}
+	}
+
+	if l.Profile != "" {
+		cfg.Profile, profileOrigin = l.Profile, Origin{File: "override"}
+	}
+
+	if cfg.Profile != "" {
+		if err := cfg.applyProfile(docs, profileOrigin); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.applyEnv(lookupEnv); err != nil {
+		return nil, err
+	}
+
+	cfg.applySettings(l.Overrides, Origin{File: "override"})
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+type section struct {
+	name string
+	node *yaml.Node
+}
+
+// document is a parsed config file.
+type document struct {
+	path          string
+	sections      []section
+	profile       string
+	profileOrigin Origin
+	profiles      map[string][]section
+}
+
+// parseFile parses `path`, and its includes. Included documents come first.
+func parseFile(path string, visiting map[string]bool) ([]*document, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if visiting[abs] {
+		return nil, &Error{Origin: Origin{File: path}, Msg: "include cycle"}
+	}
+
+	visiting[abs] = true
+	defer delete(visiting, abs)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, &Error{Origin: Origin{File: path}, Msg: err.Error()}
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, &Error{Origin: Origin{File: path}, Msg: err.Error()}
+	}
+
+	d := &document{path: path, profiles: make(map[string][]section)}
+
+	// Empty file.
+	if len(root.Content) == 0 {
+		return []*document{d}, nil
+	}
+
+	top := root.Content[0]
+	if top.Kind != yaml.MappingNode {
+		return nil, nodeError(path, top, "", "expected a mapping")
+	}
+
+	var docs []*document
+
+	for i := 0; i+1 < len(top.Content); i += 2 {
+		key, val := top.Content[i], top.Content[i+1]
+
+		switch key.Value {
+		case "include":
+			var includes []string
+			if val.Kind == yaml.ScalarNode {
+				includes = []string{val.Value}
+			} else if err := val.Decode(&includes); err != nil {
+				return nil, nodeError(path, val, "include", "expected a list of paths")
+			}
+
+			for _, inc := range includes {
+				if !filepath.IsAbs(inc) {
+					inc = filepath.Join(filepath.Dir(path), inc)
+				}
+
+				included, err := parseFile(inc, visiting)
+				if err != nil {
+					return nil, err
+				}
+
+				docs = append(docs, included...)
+			}
+		case "profile":
+			if val.Kind != yaml.ScalarNode {
+				return nil, nodeError(path, val, "profile", "expected a profile name")
+			}
+
+			d.profile, d.profileOrigin = val.Value, Origin{File: path, Line: val.Line}
+		case "client", "tunnel":
+			d.sections = append(d.sections, section{name: key.Value, node: val})
+		case "profiles":
+			if err := d.parseProfiles(val); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, nodeError(path, key, key.Value, "unknown setting")
+		}
+	}
+
+	return append(docs, d), nil
+}
+
+func (d *document) parseProfiles(node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		return nodeError(d.path, node, "profiles", "expected a mapping of profiles")
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		name, profile := node.Content[i], node.Content[i+1]
+		if profile.Kind != yaml.MappingNode {
+			return nodeError(d.path, profile, "profiles."+name.Value, "expected a mapping")
+		}
+
+		var sections []section
+
+		for j := 0; j+1 < len(profile.Content); j += 2 {
+			key, val := profile.Content[j], profile.Content[j+1]
+			if key.Value != "client" && key.Value != "tunnel" {
+				return nodeError(d.path, key, "profiles."+name.Value+"."+key.Value, "unknown setting")
+			}
+
+			sections = append(sections, section{name: key.Value, node: val})
+		}
+
+		d.profiles[name.Value] = sections
+	}
+
+	return nil
+}
+
+func (c *Config) applyProfile(docs []*document, origin Origin) error {
+	found := false
+
+	for _, d := range docs {
+		sections, ok := d.profiles[c.Profile]
+		if !ok {
+			continue
+		}
+
+		found = true
+
+		for _, s := range sections {
+			if err := c.applyNode(s.name, s.node, d.path); err != nil {
+				return err
+			}
+		}
+	}
+
+	if !found {
+		return &Error{Origin: origin, Key: "profile", Msg: fmt.Sprintf("unknown profile %q", c.Profile)}
+	}
+
+	return nil
+}
+
+// applyNode applies the settings of a "client" or "tunnel" mapping.
+func (c *Config) applyNode(name string, node *yaml.Node, path string) error {
+	if node.Kind != yaml.MappingNode {
+		return nodeError(path, node, name, "expected a mapping")
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, val := node.Content[i], node.Content[i+1]
+		fullKey := name + "." + key.Value
+
+		field, ok := c.field(fullKey)
+		if !ok {
+			return nodeError(path, key, fullKey, "unknown setting")
+		}
+
+		v := reflect.New(field.Type())
+		if err := val.Decode(v.Interface()); err != nil {
+			return nodeError(path, val, fullKey, fmt.Sprintf("invalid value, expected %s", describe(field.Type())))
+		}
+
+		field.Set(v.Elem())
+		c.origins[fullKey] = Origin{File: path, Line: val.Line}
+	}
+
+	return nil
+}
+
+func (c *Config) applyEnv(lookupEnv func(string) (string, bool)) error {
+	for name, key := range EnvVars {
+		v, ok := lookupEnv(name)
+		if !ok || v == "" {
+			continue
+		}
+
+		field, _ := c.field(key)
+		origin := Origin{File: "env " + name}
+
+		if err := setString(field, v); err != nil {
+			return &Error{Origin: origin, Key: key, Msg: err.Error()}
+		}
+
+		c.origins[key] = origin
+	}
+
+	return nil
+}
+
+// applySettings applies the non-nil fields of `s`.
+func (c *Config) applySettings(s Settings, origin Origin) {
+	src := reflect.ValueOf(s)
+	t := src.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		sectionName := tagName(t.Field(i))
+		sectionValue := src.Field(i)
+
+		for j := 0; j < sectionValue.NumField(); j++ {
+			if sectionValue.Field(j).IsNil() {
+				continue
+			}
+
+			key := sectionName + "." + tagName(sectionValue.Type().Field(j))
+			field, _ := c.field(key)
+			field.Set(sectionValue.Field(j))
+			c.origins[key] = origin
+		}
+	}
+}
+
+// field returns the settings field of `key`, e.g. "client.user".
+func (c *Config) field(key string) (reflect.Value, bool) {
+	sectionName, name, ok := strings.Cut(key, ".")
+	if !ok {
+		return reflect.Value{}, false
+	}
+
+	settings := reflect.ValueOf(&c.Settings).Elem()
+
+	for i := 0; i < settings.NumField(); i++ {
+		if tagName(settings.Type().Field(i)) != sectionName {
+			continue
+		}
+
+		section := settings.Field(i)
+
+		for j := 0; j < section.NumField(); j++ {
+			if tagName(section.Type().Field(j)) == name {
+				return section.Field(j), true
+			}
+		}
+	}
+
+	return reflect.Value{}, false
+}
+
+// setString sets a settings field from its string form.
+func setString(field reflect.Value, s string) error {
+	switch field.Interface().(type) {
+	case *string:
+		field.Set(reflect.ValueOf(&s))
+	case *bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("invalid value %q, expected boolean", s)
+		}
+
+		field.Set(reflect.ValueOf(&b))
+	case []string:
+		field.Set(reflect.ValueOf(splitList(s)))
+	case map[string]string:
+		m := make(map[string]string)
+
+		for _, kv := range splitList(s) {
+			k, v, ok := strings.Cut(kv, "=")
+			if !ok {
+				return fmt.Errorf("invalid value %q, expected key=value pairs", s)
+			}
+
+			m[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+
+		field.Set(reflect.ValueOf(m))
+	}
+
+	return nil
+}
+
+func splitList(s string) []string {
+	var out []string
+
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+
+	return out
+}
+
+func tagName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+
+	return name
+}
+
+func describe(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Ptr:
+		if t.Elem().Kind() == reflect.Bool {
+			return "boolean"
+		}
+
+		return "string"
+	case reflect.Slice:
+		return "list of strings"
+	case reflect.Map:
+		return "mapping of strings"
+	default:
+		return t.String()
+	}
+}
+
+func nodeError(path string, node *yaml.Node, key, msg string) *Error {
+	return &Error{Origin: Origin{File: path, Line: node.Line}, Key: key, Msg: msg}
+}
@@ -0,0 +1,450 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	rest "github.com/saucelabs/tunnelrest-go"
+	"gopkg.in/yaml.v3"
+)
+
+type optionKind int
+
+const (
+	stringOption optionKind = iota
+	boolOption
+	listOption
+)
+
+// option is a Sauce Connect config key, or command line flag.
+type option struct {
+	kind optionKind
+	// short is the one letter flag, if any.
+	short string
+	// aliases are deprecated names of the option.
+	aliases []string
+	// unsupported options are valid Sauce Connect options without a REST API
+	// equivalent, e.g. the log file.
+	unsupported bool
+}
+
+// sc4Options are the Sauce Connect 4 options, keyed by long name.
+var sc4Options = map[string]option{
+	"user":                {kind: stringOption, short: "u"},
+	"api-key":             {kind: stringOption, short: "k"},
+	"region":              {kind: stringOption, short: "r"},
+	"rest-url":            {kind: stringOption, short: "x"},
+	"tunnel-name":         {kind: stringOption, short: "i", aliases: []string{"tunnel-identifier"}},
+	"shared-tunnel":       {kind: boolOption, short: "s"},
+	"tunnel-pool":         {kind: boolOption},
+	"tunnel-domains":      {kind: listOption, short: "t"},
+	"direct-domains":      {kind: listOption, short: "D"},
+	"no-ssl-bump-domains": {kind: listOption, short: "B"},
+	"fast-fail-regexps":   {kind: listOption, short: "F"},
+	"no-proxy-caching":    {kind: boolOption, short: "N"},
+	"extra-info":          {kind: stringOption},
+	"vm-version":          {kind: stringOption},
+	"config-file":         {kind: stringOption, short: "c"},
+
+	"logfile":                     {kind: stringOption, short: "l", unsupported: true},
+	"max-logsize":                 {kind: stringOption, unsupported: true},
+	"pidfile":                     {kind: stringOption, short: "d", unsupported: true},
+	"readyfile":                   {kind: stringOption, short: "f", unsupported: true},
+	"verbose":                     {kind: boolOption, short: "v", unsupported: true},
+	"proxy":                       {kind: stringOption, short: "p", unsupported: true},
+	"proxy-userpwd":               {kind: stringOption, short: "w", unsupported: true},
+	"proxy-tunnel":                {kind: boolOption, short: "T", unsupported: true},
+	"pac":                         {kind: stringOption, unsupported: true},
+	"scproxy-port":                {kind: stringOption, unsupported: true},
+	"se-port":                     {kind: stringOption, short: "P", unsupported: true},
+	"dns":                         {kind: stringOption, unsupported: true},
+	"status-address":              {kind: stringOption, unsupported: true},
+	"metrics-address":             {kind: stringOption, unsupported: true},
+	"no-remove-colliding-tunnels": {kind: boolOption, unsupported: true},
+	"no-autodetect":               {kind: boolOption, unsupported: true},
+	"tunnel-cert":                 {kind: stringOption, unsupported: true},
+}
+
+// sc5Options are the Sauce Connect 5 options, keyed by long name.
+var sc5Options = map[string]option{
+	"username":                {kind: stringOption, short: "u"},
+	"access-key":              {kind: stringOption, short: "k"},
+	"region":                  {kind: stringOption, short: "r"},
+	"tunnel-name":             {kind: stringOption, short: "i"},
+	"tunnel-pool":             {kind: boolOption},
+	"shared":                  {kind: stringOption, short: "s"},
+	"tunnel-domains":          {kind: listOption, short: "t"},
+	"direct-domains":          {kind: listOption, short: "D"},
+	"deny-domains":            {kind: listOption, short: "F"},
+	"tls-resign-domains":      {kind: listOption, short: "b"},
+	"tls-passthrough-domains": {kind: listOption, short: "B"},
+	"config-file":             {kind: stringOption, short: "c"},
+
+	"api-address":        {kind: stringOption, unsupported: true},
+	"cacert-file":        {kind: listOption, unsupported: true},
+	"dns-server":         {kind: listOption, unsupported: true},
+	"log-file":           {kind: stringOption, unsupported: true},
+	"log-level":          {kind: stringOption, unsupported: true},
+	"metadata":           {kind: stringOption, unsupported: true},
+	"proxy":              {kind: listOption, short: "x", unsupported: true},
+	"proxy-localhost":    {kind: stringOption, unsupported: true},
+	"proxy-sauce":        {kind: stringOption, unsupported: true},
+	"tunnel-timeout":     {kind: stringOption, unsupported: true},
+	"tunnel-connections": {kind: stringOption, unsupported: true},
+}
+
+// NativeConfig are the settings parsed from a Sauce Connect config file, or
+// command line.
+type NativeConfig struct {
+	// Client settings, i.e. the credentials and the region.
+	Client ClientSettings
+	// Unknown are the keys or flags that aren't Sauce Connect options.
+	Unknown []string
+	// Unsupported are the Sauce Connect options without a REST API
+	// equivalent, e.g. the log file.
+	Unsupported []string
+}
+
+// NewClient returns a REST API client for the validated client settings.
+func (n *NativeConfig) NewClient() (*rest.Client, error) {
+	return (&Config{Settings: Settings{Client: n.Client}}).NewClient()
+}
+
+// SC4Config is a parsed Sauce Connect 4 config.
+type SC4Config struct {
+	NativeConfig
+	Request *rest.CreateTunnelRequestV4
+}
+
+// SC5Config is a parsed Sauce Connect 5 config.
+type SC5Config struct {
+	NativeConfig
+	Request *rest.CreateTunnelRequestV5
+}
+
+// ParseSC4File parses a Sauce Connect 4 YAML config file.
+func ParseSC4File(path string) (*SC4Config, error) {
+	values, n, err := parseNativeFile(path, sc4Options)
+	if err != nil {
+		return nil, err
+	}
+
+	return newSC4Config(values, n), nil
+}
+
+// ParseSC4Args parses Sauce Connect 4 command line arguments. The file passed
+// with --config-file, if any, is parsed first, and the arguments override it.
+func ParseSC4Args(args []string) (*SC4Config, error) {
+	values, n, err := parseNativeArgs(args, sc4Options)
+	if err != nil {
+		return nil, err
+	}
+
+	return newSC4Config(values, n), nil
+}
+
+// ParseSC5File parses a Sauce Connect 5 YAML config file.
+func ParseSC5File(path string) (*SC5Config, error) {
+	values, n, err := parseNativeFile(path, sc5Options)
+	if err != nil {
+		return nil, err
+	}
+
+	return newSC5Config(values, n), nil
+}
+
+// ParseSC5Args parses Sauce Connect 5 command line arguments. The file passed
+// with --config-file, if any, is parsed first, and the arguments override it.
+func ParseSC5Args(args []string) (*SC5Config, error) {
+	values, n, err := parseNativeArgs(args, sc5Options)
+	if err != nil {
+		return nil, err
+	}
+
+	return newSC5Config(values, n), nil
+}
+
+func newSC4Config(v nativeValues, n NativeConfig) *SC4Config {
+	n.Client = ClientSettings{
+		User:    v.stringPtr("user"),
+		APIKey:  v.stringPtr("api-key"),
+		Region:  v.stringPtr("region"),
+		BaseURL: v.stringPtr("rest-url"),
+	}
+
+	req := &rest.CreateTunnelRequestV4{
+		TunnelIdentifier: v.stringPtr("tunnel-name"),
+		SharedTunnel:     v.bool("shared-tunnel"),
+		TunnelPool:       v.bool("tunnel-pool"),
+		NoProxyCaching:   v.bool("no-proxy-caching"),
+		DomainNames:      v.list("tunnel-domains"),
+		DirectDomains:    v.list("direct-domains"),
+		NoSSLBumpDomains: v.list("no-ssl-bump-domains"),
+		FastFailRegexps:  v.list("fast-fail-regexps"),
+		ExtraInfo:        v.string("extra-info"),
+		VMVersion:        v.string("vm-version"),
+	}
+
+	return &SC4Config{NativeConfig: n, Request: req}
+}
+
+func newSC5Config(v nativeValues, n NativeConfig) *SC5Config {
+	n.Client = ClientSettings{
+		User:   v.stringPtr("username"),
+		APIKey: v.stringPtr("access-key"),
+		Region: v.stringPtr("region"),
+	}
+
+	req := &rest.CreateTunnelRequestV5{
+		TunnelIdentifier:      v.string("tunnel-name"),
+		Shared:                v.string("shared"),
+		TunnelPool:            v.bool("tunnel-pool"),
+		TunnelDomains:         v.list("tunnel-domains"),
+		DirectDomains:         v.list("direct-domains"),
+		DenyDomains:           v.list("deny-domains"),
+		TLSResignDomains:      v.list("tls-resign-domains"),
+		TLSPassthroughDomains: v.list("tls-passthrough-domains"),
+	}
+
+	req.SharedTunnel = req.Shared != ""
+
+	return &SC5Config{NativeConfig: n, Request: req}
+}
+
+// nativeValues are option values keyed by long name. Values are either
+// strings, booleans or lists of strings.
+type nativeValues map[string]interface{}
+
+func (v nativeValues) string(name string) string {
+	s, _ := v[name].(string)
+
+	return s
+}
+
+func (v nativeValues) stringPtr(name string) *string {
+	if s, ok := v[name].(string); ok {
+		return &s
+	}
+
+	return nil
+}
+
+func (v nativeValues) bool(name string) bool {
+	b, _ := v[name].(bool)
+
+	return b
+}
+
+func (v nativeValues) list(name string) []string {
+	l, _ := v[name].([]string)
+
+	return l
+}
+
+// lookupOption returns the long name of an option from any of its names.
+func lookupOption(options map[string]option, name string) (string, option, bool) {
+	if o, ok := options[name]; ok {
+		return name, o, true
+	}
+
+	for long, o := range options {
+		if (o.short != "" && o.short == name) || contains(o.aliases, name) {
+			return long, o, true
+		}
+	}
+
+	return "", option{}, false
+}
+
+func parseNativeFile(path string, options map[string]option) (nativeValues, NativeConfig, error) {
+	var n NativeConfig
+
+	values := make(nativeValues)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, n, &Error{Origin: Origin{File: path}, Msg: err.Error()}
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, n, &Error{Origin: Origin{File: path}, Msg: err.Error()}
+	}
+
+	if len(root.Content) == 0 {
+		return values, n, nil
+	}
+
+	top := root.Content[0]
+	if top.Kind != yaml.MappingNode {
+		return nil, n, nodeError(path, top, "", "expected a mapping")
+	}
+
+	for i := 0; i+1 < len(top.Content); i += 2 {
+		key, val := top.Content[i], top.Content[i+1]
+
+		name, o, ok := lookupOption(options, key.Value)
+		if !ok {
+			n.Unknown = append(n.Unknown, key.Value)
+
+			continue
+		}
+
+		if o.unsupported {
+			n.Unsupported = append(n.Unsupported, name)
+
+			continue
+		}
+
+		v, err := decodeOption(o, val)
+		if err != nil {
+			return nil, n, nodeError(path, val, name, err.Error())
+		}
+
+		values[name] = v
+	}
+
+	return values, n, nil
+}
+
+func decodeOption(o option, node *yaml.Node) (interface{}, error) {
+	switch o.kind {
+	case boolOption:
+		b, err := strconv.ParseBool(node.Value)
+		if node.Kind != yaml.ScalarNode || err != nil {
+			return nil, fmt.Errorf("invalid value %q, expected boolean", node.Value)
+		}
+
+		return b, nil
+	case listOption:
+		if node.Kind == yaml.ScalarNode {
+			return splitList(node.Value), nil
+		}
+
+		var l []string
+		if err := node.Decode(&l); err != nil {
+			return nil, fmt.Errorf("invalid value, expected list of strings")
+		}
+
+		return l, nil
+	default:
+		if node.Kind != yaml.ScalarNode {
+			return nil, fmt.Errorf("invalid value, expected string")
+		}
+
+		return node.Value, nil
+	}
+}
+
+func parseNativeArgs(args []string, options map[string]option) (nativeValues, NativeConfig, error) {
+	var n NativeConfig
+
+	values := make(nativeValues)
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			n.Unknown = append(n.Unknown, arg)
+
+			continue
+		}
+
+		flag, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+
+		name, o, ok := lookupOption(options, flag)
+		if !ok || o.kind != boolOption {
+			if !hasValue && i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+				i++
+				value, hasValue = args[i], true
+			}
+		}
+
+		if !ok {
+			n.Unknown = append(n.Unknown, arg)
+
+			continue
+		}
+
+		if o.unsupported {
+			n.Unsupported = append(n.Unsupported, name)
+
+			continue
+		}
+
+		switch o.kind {
+		case boolOption:
+			b := true
+
+			if hasValue {
+				var err error
+				if b, err = strconv.ParseBool(value); err != nil {
+					return nil, n, &Error{Key: name, Msg: fmt.Sprintf("invalid value %q, expected boolean", value)}
+				}
+			}
+
+			values[name] = b
+		case listOption:
+			if !hasValue {
+				return nil, n, &Error{Key: name, Msg: "missing value"}
+			}
+
+			// Repeated list flags are accumulated.
+			l, _ := values[name].([]string)
+			values[name] = append(l, splitList(value)...)
+		default:
+			if !hasValue {
+				return nil, n, &Error{Key: name, Msg: "missing value"}
+			}
+
+			values[name] = value
+		}
+	}
+
+	configFile, ok := values["config-file"].(string)
+	if !ok {
+		return values, n, nil
+	}
+
+	fileValues, fileConfig, err := parseNativeFile(configFile, options)
+	if err != nil {
+		return nil, n, err
+	}
+
+	for k, v := range values {
+		fileValues[k] = v
+	}
+
+	n.Unknown = mergeNames(fileConfig.Unknown, n.Unknown)
+	n.Unsupported = mergeNames(fileConfig.Unsupported, n.Unsupported)
+
+	return fileValues, n, nil
+}
+
+// mergeNames returns the names in `a` followed by the ones in `b`, without
+// duplicates.
+func mergeNames(a, b []string) []string {
+	seen := make(map[string]bool)
+
+	var out []string
+
+	for _, s := range append(append([]string{}, a...), b...) {
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+
+	return out
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
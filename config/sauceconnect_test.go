@@ -0,0 +1,89 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSC4File(t *testing.T) {
+	cfg, err := ParseSC4File(testdata("sc/sc4.yaml"))
+	assert.NoError(t, err)
+
+	assert.Equal(t, "legacy", *cfg.Request.TunnelIdentifier)
+	assert.True(t, cfg.Request.SharedTunnel)
+	assert.Equal(t, []string{"a.example.com", "b.example.com"}, cfg.Request.DomainNames)
+	assert.Equal(t, []string{`.*\.ads\.com`}, cfg.Request.FastFailRegexps)
+	assert.Equal(t, []string{"cert-pinning"}, cfg.Unknown)
+	assert.Equal(t, []string{"logfile", "se-port"}, cfg.Unsupported)
+
+	client, err := cfg.NewClient()
+	assert.NoError(t, err)
+	assert.Equal(t, "https://api.eu-central-1.saucelabs.com/rest/v1", client.BaseURL)
+	assert.Equal(t, "bob", client.User)
+	assert.Equal(t, "secret", client.APIKey)
+}
+
+func TestParseSC4Args(t *testing.T) {
+	cfg, err := ParseSC4Args([]string{
+		"--config-file", testdata("sc/sc4.yaml"),
+		"-i", "from-flag",
+		"-s=false",
+		"--no-proxy-caching",
+		"-D", "a.com", "-D", "b.com",
+		"--bogus", "value",
+		"-v",
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, "from-flag", *cfg.Request.TunnelIdentifier)
+	assert.False(t, cfg.Request.SharedTunnel)
+	assert.True(t, cfg.Request.NoProxyCaching)
+	assert.Equal(t, []string{"a.com", "b.com"}, cfg.Request.DirectDomains)
+	assert.Equal(t, []string{"a.example.com", "b.example.com"}, cfg.Request.DomainNames)
+	assert.Equal(t, []string{"cert-pinning", "--bogus"}, cfg.Unknown)
+	assert.Equal(t, []string{"logfile", "se-port", "verbose"}, cfg.Unsupported)
+}
+
+func TestParseSC5File(t *testing.T) {
+	cfg, err := ParseSC5File(testdata("sc/sc5.yaml"))
+	assert.NoError(t, err)
+
+	assert.Equal(t, "app", cfg.Request.TunnelIdentifier)
+	assert.Equal(t, "all", cfg.Request.Shared)
+	assert.True(t, cfg.Request.SharedTunnel)
+	assert.True(t, cfg.Request.TunnelPool)
+	assert.Equal(t, []string{"ads.example.com"}, cfg.Request.DenyDomains)
+	assert.Equal(t, []string{"internal.example.com"}, cfg.Request.TLSResignDomains)
+	assert.Equal(t, []string{"unknown-option"}, cfg.Unknown)
+	assert.Equal(t, []string{"log-level"}, cfg.Unsupported)
+
+	client, err := cfg.NewClient()
+	assert.NoError(t, err)
+	assert.Equal(t, "https://api.us-west-1.saucelabs.com/rest/v1", client.BaseURL)
+}
+
+func TestParseSC5Args(t *testing.T) {
+	cfg, err := ParseSC5Args([]string{"-u", "alice", "-k=key", "--region", "eu", "--tunnel-name", "t", "--tunnel-pool"})
+	assert.NoError(t, err)
+
+	assert.Equal(t, "t", cfg.Request.TunnelIdentifier)
+	assert.True(t, cfg.Request.TunnelPool)
+	assert.Empty(t, cfg.Unknown)
+
+	client, err := cfg.NewClient()
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", client.User)
+	assert.Equal(t, "https://api.eu-central-1.saucelabs.com/rest/v1", client.BaseURL)
+}
+
+func TestParseSCErrors(t *testing.T) {
+	_, err := ParseSC5File(testdata("sc/bad.yaml"))
+	assert.EqualError(t, err, testdata("sc/bad.yaml")+`:2: tunnel-pool: invalid value "sometimes", expected boolean`)
+
+	_, err = ParseSC5Args([]string{"--tunnel-name"})
+	assert.EqualError(t, err, "tunnel-name: missing value")
+
+	_, err = ParseSC4Args([]string{"--shared-tunnel=maybe"})
+	assert.EqualError(t, err, `shared-tunnel: invalid value "maybe", expected boolean`)
+}
@@ -0,0 +1,159 @@
+package rest
+
+import (
+	"fmt"
+	"time"
+)
+
+// DefaultClientConfiguration are the library defaults for configuration
+// values that neither the server nor local overrides set.
+var DefaultClientConfiguration = ClientConfiguration{
+	JobWaitTimeout:       300,
+	KGPHandshakeTimeout:  15,
+	MaxMissedAcks:        300,
+	ClientStatusInterval: 30,
+	ClientStatusTimeout:  15,
+	ServerStatusInterval: 10,
+	ServerStatusTimeout:  5,
+	StartTimeout:         45,
+}
+
+// maxConfigurationSeconds is the upper bound of timeouts and intervals.
+const maxConfigurationSeconds = 24 * 60 * 60
+
+// configurationField describes an integer ClientConfiguration field. Zero
+// values are unset.
+type configurationField struct {
+	name  string
+	value *int
+	max   int
+}
+
+func (c *ClientConfiguration) fields() []configurationField {
+	return []configurationField{
+		{"job_wait_timeout", &c.JobWaitTimeout, maxConfigurationSeconds},
+		{"kgp_handshake_timeout", &c.KGPHandshakeTimeout, maxConfigurationSeconds},
+		{"max_missed_acks", &c.MaxMissedAcks, 1 << 20},
+		{"client_status_interval", &c.ClientStatusInterval, maxConfigurationSeconds},
+		{"client_status_timeout", &c.ClientStatusTimeout, maxConfigurationSeconds},
+		{"scproxy_write_limit", &c.ScproxyWriteLimit, 1 << 30},
+		{"scproxy_read_limit", &c.ScproxyReadLimit, 1 << 30},
+		{"server_status_interval", &c.ServerStatusInterval, maxConfigurationSeconds},
+		{"server_status_timeout", &c.ServerStatusTimeout, maxConfigurationSeconds},
+		{"start_timeout", &c.StartTimeout, maxConfigurationSeconds},
+	}
+}
+
+// duration returns `v` seconds, or the default if `v` is unset.
+func duration(v, def int) time.Duration {
+	if v == 0 {
+		v = def
+	}
+
+	return time.Duration(v) * time.Second
+}
+
+// JobWait returns the time to wait for running jobs before shutting down.
+func (c ClientConfiguration) JobWait() time.Duration {
+	return duration(c.JobWaitTimeout, DefaultClientConfiguration.JobWaitTimeout)
+}
+
+// KGPHandshake returns the KGP handshake timeout.
+func (c ClientConfiguration) KGPHandshake() time.Duration {
+	return duration(c.KGPHandshakeTimeout, DefaultClientConfiguration.KGPHandshakeTimeout)
+}
+
+// ClientStatusEvery returns the interval of client status updates.
+func (c ClientConfiguration) ClientStatusEvery() time.Duration {
+	return duration(c.ClientStatusInterval, DefaultClientConfiguration.ClientStatusInterval)
+}
+
+// ClientStatusWait returns the client status update timeout.
+func (c ClientConfiguration) ClientStatusWait() time.Duration {
+	return duration(c.ClientStatusTimeout, DefaultClientConfiguration.ClientStatusTimeout)
+}
+
+// ServerStatusEvery returns the interval of server status checks.
+func (c ClientConfiguration) ServerStatusEvery() time.Duration {
+	return duration(c.ServerStatusInterval, DefaultClientConfiguration.ServerStatusInterval)
+}
+
+// ServerStatusWait returns the server status check timeout.
+func (c ClientConfiguration) ServerStatusWait() time.Duration {
+	return duration(c.ServerStatusTimeout, DefaultClientConfiguration.ServerStatusTimeout)
+}
+
+// StartWait returns the tunnel start timeout.
+func (c ClientConfiguration) StartWait() time.Duration {
+	return duration(c.StartTimeout, DefaultClientConfiguration.StartTimeout)
+}
+
+// MissedAcks returns the number of missed acknowledgements tolerated before
+// the connection is considered lost.
+func (c ClientConfiguration) MissedAcks() int {
+	if c.MaxMissedAcks == 0 {
+		return DefaultClientConfiguration.MaxMissedAcks
+	}
+
+	return c.MaxMissedAcks
+}
+
+// WithDefaults returns the configuration with unset values taken from
+// DefaultClientConfiguration.
+func (c ClientConfiguration) WithDefaults() ClientConfiguration {
+	return MergeClientConfiguration(DefaultClientConfiguration, c)
+}
+
+// ConfigurationRangeError is returned for out of range configuration values.
+type ConfigurationRangeError struct {
+	// Field is the JSON name of the field.
+	Field string
+	Value int
+	Max   int
+}
+
+// Error interface implementation.
+func (e *ConfigurationRangeError) Error() string {
+	return fmt.Sprintf("configuration %s: %d is out of range [0, %d]", e.Field, e.Value, e.Max)
+}
+
+// Validate checks that the values are in range. Timeouts and intervals must
+// not exceed a day.
+func (c ClientConfiguration) Validate() error {
+	for _, f := range c.fields() {
+		if *f.value < 0 || *f.value > f.max {
+			return &ConfigurationRangeError{Field: f.name, Value: *f.value, Max: f.max}
+		}
+	}
+
+	return nil
+}
+
+// MergeClientConfiguration combines `layers`, later layers take precedence,
+// e.g. MergeClientConfiguration(server, local) applies local overrides to the
+// server provided configuration. Zero values and empty lists are unset, and
+// don't override earlier layers.
+func MergeClientConfiguration(layers ...ClientConfiguration) ClientConfiguration {
+	var merged ClientConfiguration
+
+	for _, l := range layers {
+		l := l
+
+		src := l.fields()
+		for i, f := range merged.fields() {
+			if *src[i].value != 0 {
+				*f.value = *src[i].value
+			}
+		}
+
+		if len(l.Experimental) > 0 {
+			merged.Experimental = l.Experimental
+		}
+
+		if len(l.Regions) > 0 {
+			merged.Regions = l.Regions
+		}
+	}
+
+	return merged
+}
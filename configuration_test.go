@@ -0,0 +1,71 @@
+package rest
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/saucelabs/tunnelrest-go/region"
+	assertLib "github.com/stretchr/testify/assert"
+)
+
+func TestClientConfigurationDurations(t *testing.T) {
+	assert := assertLib.New(t)
+
+	var c ClientConfiguration
+	assert.NoError(json.Unmarshal([]byte(`{"job_wait_timeout": 120, "start_timeout": 90}`), &c))
+
+	assert.Equal(2*time.Minute, c.JobWait())
+	assert.Equal(90*time.Second, c.StartWait())
+	assert.Equal(15*time.Second, c.KGPHandshake())
+	assert.Equal(30*time.Second, c.ClientStatusEvery())
+	assert.Equal(15*time.Second, c.ClientStatusWait())
+	assert.Equal(10*time.Second, c.ServerStatusEvery())
+	assert.Equal(5*time.Second, c.ServerStatusWait())
+	assert.Equal(300, c.MissedAcks())
+
+	d := c.WithDefaults()
+	assert.Equal(120, d.JobWaitTimeout)
+	assert.Equal(15, d.KGPHandshakeTimeout)
+	assert.Equal(0, d.ScproxyReadLimit)
+}
+
+func TestClientConfigurationValidate(t *testing.T) {
+	assert := assertLib.New(t)
+
+	assert.NoError(scConfiguration.Validate())
+	assert.NoError(ClientConfiguration{}.Validate())
+
+	err := ClientConfiguration{StartTimeout: -1}.Validate()
+	assert.EqualError(err, "configuration start_timeout: -1 is out of range [0, 86400]")
+
+	// Milliseconds by mistake.
+	err = ClientConfiguration{JobWaitTimeout: 300000}.Validate()
+	assert.IsType(&ConfigurationRangeError{}, err)
+}
+
+func TestMergeClientConfiguration(t *testing.T) {
+	assert := assertLib.New(t)
+
+	server := ClientConfiguration{
+		JobWaitTimeout: 300,
+		StartTimeout:   45,
+		Experimental:   []string{"http2"},
+		Regions:        []region.Region{{Name: "us-west-1"}},
+	}
+	local := ClientConfiguration{
+		StartTimeout:     120,
+		ScproxyReadLimit: 10,
+	}
+
+	merged := MergeClientConfiguration(DefaultClientConfiguration, server, local)
+	assert.Equal(300, merged.JobWaitTimeout)
+	assert.Equal(120, merged.StartTimeout)
+	assert.Equal(10, merged.ScproxyReadLimit)
+	assert.Equal(15, merged.KGPHandshakeTimeout)
+	assert.Equal([]string{"http2"}, merged.Experimental)
+	assert.Equal(server.Regions, merged.Regions)
+
+	// The layers are left unchanged.
+	assert.Equal(45, server.StartTimeout)
+}
@@ -0,0 +1,187 @@
+package rest
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// sharedAll is the Sauce Connect 5 value for a tunnel shared with the org.
+const sharedAll = "all"
+
+var (
+	// Host-only regexps after the scheme and path wildcards are stripped,
+	// e.g. `example\.com`.
+	escapedDomainRe = regexp.MustCompile(`^[a-zA-Z0-9-]+(\\\.[a-zA-Z0-9-]+)*$`)
+
+	fastFailPrefixes = []string{"(https?://)?", "https?://", "http://", "https://", ".*://"}
+	// The host must be followed by the end of the URL, or its path. A `.*`
+	// suffix would also match longer hosts, e.g. "example.com.evil.org", and
+	// so would an unanchored `(/.*)?`, which may match nothing.
+	fastFailSuffixes = []string{"(/.*)?$", "/.*$", "/$", "$", "/.*", "/"}
+)
+
+// ConversionIssue describes a field that couldn't be converted as is.
+type ConversionIssue struct {
+	// Field is the JSON name of the Sauce Connect 4 field.
+	Field string
+	// Value is the offending value, if any.
+	Value string
+	// Reason explains why the value was dropped or changed.
+	Reason string
+}
+
+// String interface implementation.
+func (i ConversionIssue) String() string {
+	if i.Value == "" {
+		return fmt.Sprintf("%s: %s", i.Field, i.Reason)
+	}
+
+	return fmt.Sprintf("%s %q: %s", i.Field, i.Value, i.Reason)
+}
+
+// ConversionReport lists lossy or unsupported conversions.
+type ConversionReport struct {
+	Issues []ConversionIssue
+}
+
+// Lossy reports whether some information was lost during the conversion.
+func (r *ConversionReport) Lossy() bool {
+	return len(r.Issues) > 0
+}
+
+func (r *ConversionReport) add(field, value, reason string) {
+	r.Issues = append(r.Issues, ConversionIssue{Field: field, Value: value, Reason: reason})
+}
+
+// ConvertV4ToV5 converts a Sauce Connect 4 tunnel request to a Sauce Connect 5
+// one. Fast fail regexps are translated to deny domains where the regexp
+// matches hosts only. Everything that can't be expressed in Sauce Connect 5 is
+// listed in the returned report.
+func ConvertV4ToV5(req *CreateTunnelRequestV4) (*CreateTunnelRequestV5, ConversionReport) {
+	var report ConversionReport
+
+	out := &CreateTunnelRequestV5{
+		Protocol:              string(H2CProtocol),
+		SharedTunnel:          req.SharedTunnel,
+		TunnelPool:            req.TunnelPool,
+		TunnelDomains:         copyStrings(req.DomainNames),
+		DirectDomains:         copyStrings(req.DirectDomains),
+		TLSPassthroughDomains: copyStrings(req.NoSSLBumpDomains),
+		Metadata:              req.Metadata,
+	}
+
+	if req.TunnelIdentifier != nil {
+		out.TunnelIdentifier = *req.TunnelIdentifier
+	}
+
+	if req.SharedTunnel {
+		out.Shared = sharedAll
+	}
+
+	for _, re := range req.FastFailRegexps {
+		domains, ok := fastFailToDenyDomains(re)
+		if !ok {
+			report.add("fast_fail_regexps", re, "can't be expressed as deny domains")
+
+			continue
+		}
+
+		out.DenyDomains = append(out.DenyDomains, domains...)
+	}
+
+	if req.KGPPort != 0 {
+		report.add("ssh_port", fmt.Sprint(req.KGPPort), "KGP port is not used by Sauce Connect 5")
+	}
+
+	if req.NoProxyCaching {
+		report.add("no_proxy_caching", "", "proxy caching is not supported by Sauce Connect 5")
+	}
+
+	if req.ExtraInfo != "" {
+		report.add("extra_info", req.ExtraInfo, "not supported by Sauce Connect 5")
+	}
+
+	if req.VMVersion != "" {
+		report.add("vm_version", req.VMVersion, "not supported by Sauce Connect 5")
+	}
+
+	return out, report
+}
+
+// fastFailToDenyDomains translates a fast fail regexp matching URLs into
+// deny domains, e.g. `^https?://(.*\.)?example\.com/.*` into "example.com"
+// and "*.example.com". Only regexps anchored at both ends of the host are
+// translated, others match more than the domains.
+func fastFailToDenyDomains(re string) ([]string, bool) {
+	if _, err := regexp.Compile(re); err != nil {
+		return nil, false
+	}
+
+	if !strings.HasPrefix(re, "^") {
+		return nil, false
+	}
+
+	s := strings.TrimPrefix(re, "^")
+
+	for _, p := range fastFailPrefixes {
+		if strings.HasPrefix(s, p) {
+			s = strings.TrimPrefix(s, p)
+
+			break
+		}
+	}
+
+	bounded := false
+
+	for _, suffix := range fastFailSuffixes {
+		if strings.HasSuffix(s, suffix) {
+			s = strings.TrimSuffix(s, suffix)
+			bounded = true
+
+			break
+		}
+	}
+
+	if !bounded {
+		return nil, false
+	}
+
+	var withApex, withSubdomains bool
+
+	switch {
+	case strings.HasPrefix(s, `(.*\.)?`):
+		s = strings.TrimPrefix(s, `(.*\.)?`)
+		withApex, withSubdomains = true, true
+	case strings.HasPrefix(s, `.*\.`):
+		s = strings.TrimPrefix(s, `.*\.`)
+		withSubdomains = true
+	default:
+		withApex = true
+	}
+
+	if !escapedDomainRe.MatchString(s) {
+		return nil, false
+	}
+
+	domain := strings.ReplaceAll(s, `\.`, ".")
+
+	var domains []string
+	if withApex {
+		domains = append(domains, domain)
+	}
+
+	if withSubdomains {
+		domains = append(domains, "*."+domain)
+	}
+
+	return domains, true
+}
+
+func copyStrings(s []string) []string {
+	if s == nil {
+		return nil
+	}
+
+	return append([]string{}, s...)
+}
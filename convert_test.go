@@ -0,0 +1,87 @@
+package rest
+
+import (
+	"testing"
+
+	assertLib "github.com/stretchr/testify/assert"
+)
+
+func TestConvertV4ToV5(t *testing.T) {
+	assert := assertLib.New(t)
+	identifier := "my-tunnel"
+
+	req := &CreateTunnelRequestV4{
+		TunnelIdentifier: &identifier,
+		SharedTunnel:     true,
+		TunnelPool:       true,
+		NoProxyCaching:   true,
+		KGPPort:          443,
+		DomainNames:      []string{"sauce-connect.proxy"},
+		DirectDomains:    []string{"direct.example.com"},
+		NoSSLBumpDomains: []string{"bank.example.com"},
+		FastFailRegexps: []string{
+			`^.*\.google-analytics\.com/`,
+			`.*\.doubleclick\.net.*`,
+			`^https?://(.*\.)?ads\.example\.com/.*`,
+			`example\.com/tracking/.*`,
+			`^(.*\.)?tracker\.com(/.*)?`,
+		},
+		Metadata: Metadata{Hostname: "ci-1"},
+	}
+
+	out, report := ConvertV4ToV5(req)
+
+	assert.Equal(&CreateTunnelRequestV5{
+		TunnelIdentifier:      identifier,
+		Protocol:              string(H2CProtocol),
+		Shared:                "all",
+		SharedTunnel:          true,
+		TunnelPool:            true,
+		TunnelDomains:         []string{"sauce-connect.proxy"},
+		DirectDomains:         []string{"direct.example.com"},
+		DenyDomains:           []string{"*.google-analytics.com", "ads.example.com", "*.ads.example.com"},
+		TLSPassthroughDomains: []string{"bank.example.com"},
+		Metadata:              Metadata{Hostname: "ci-1"},
+	}, out)
+
+	assert.True(report.Lossy())
+	assert.Equal([]ConversionIssue{
+		{Field: "fast_fail_regexps", Value: `.*\.doubleclick\.net.*`, Reason: "can't be expressed as deny domains"},
+		{Field: "fast_fail_regexps", Value: `example\.com/tracking/.*`, Reason: "can't be expressed as deny domains"},
+		{Field: "fast_fail_regexps", Value: `^(.*\.)?tracker\.com(/.*)?`, Reason: "can't be expressed as deny domains"},
+		{Field: "ssh_port", Value: "443", Reason: "KGP port is not used by Sauce Connect 5"},
+		{Field: "no_proxy_caching", Reason: "proxy caching is not supported by Sauce Connect 5"},
+	}, report.Issues)
+}
+
+func TestFastFailToDenyDomains(t *testing.T) {
+	tests := []struct {
+		re   string
+		want []string
+		ok   bool
+	}{
+		{`^example\.com$`, []string{"example.com"}, true},
+		{`^https://example\.com/.*`, []string{"example.com"}, true},
+		{`^https?://example\.com/$`, []string{"example.com"}, true},
+		{`^.*\.example\.com$`, []string{"*.example.com"}, true},
+		{`^(.*\.)?example\.com(/.*)?$`, []string{"example.com", "*.example.com"}, true},
+		{`example\.com`, nil, false},
+		{`https://example\.com/.*`, nil, false},
+		{`.*\.example\.com`, nil, false},
+		{`^https?://example\.com.*`, nil, false},
+		{`^https?://example\.com`, nil, false},
+		{`^(.*\.)?example\.com(/.*)?`, nil, false},
+		{`^example.com$`, nil, false},
+		{`.*example\.com`, nil, false},
+		{`.*`, nil, false},
+		{`(`, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.re, func(t *testing.T) {
+			got, ok := fastFailToDenyDomains(tt.re)
+			assertLib.Equal(t, tt.ok, ok)
+			assertLib.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,282 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/saucelabs/tunnelrest-go/util"
+)
+
+const (
+	defaultCrashLogTailSize = 64 * 1024
+	defaultCrashMaxSize     = 256 * 1024
+	defaultCrashTimeout     = 10 * time.Second
+
+	crashSpoolPattern = "crash-*.json"
+	truncatedMarker   = "\n[truncated]\n"
+)
+
+// CrashReport is a crash report as submitted to, or spooled for, the REST API.
+type CrashReport struct {
+	Tunnel string    `json:"tunnel"`
+	Info   string    `json:"info"`
+	Logs   string    `json:"logs"`
+	Time   time.Time `json:"time"`
+}
+
+// CrashReporter collects crash information and submits it with ReportCrash.
+// Reports that can't be submitted are spooled to disk, and re-submitted with
+// FlushSpool.
+//
+// Usage:
+//
+//	reporter := &rest.CrashReporter{Client: client, LogFile: "sc.log"}
+//	defer reporter.Recover()
+type CrashReporter struct {
+	// Client is used to submit crash reports.
+	Client *Client
+	// TunnelID is the ID of the tunnel the report is about, if any.
+	TunnelID string
+	// LogFile is the path of the log file to attach to the report.
+	LogFile string
+	// LogTailSize is the number of bytes read from the end of the log file.
+	// Defaults to 64KB.
+	LogTailSize int64
+	// MaxSize is the maximum combined size of the info and the logs.
+	// Defaults to 256KB.
+	MaxSize int
+	// Timeout of the submission. Defaults to 10s.
+	Timeout time.Duration
+	// SpoolDir is the directory where unsubmitted reports are saved. If not
+	// set, unsubmitted reports are dropped.
+	SpoolDir string
+	// Redactor removes secrets from the info and the logs. Defaults to
+	// util.DefaultRedactor.
+	Redactor *util.Redactor
+}
+
+// Recover reports a panic, and re-panics. It must be called directly with
+// defer.
+func (r *CrashReporter) Recover() {
+	v := recover()
+	if v == nil {
+		return
+	}
+
+	_ = r.Report(fmt.Sprintf("panic: %v\n\n%s", v, goroutineDump()))
+
+	panic(v)
+}
+
+// Report submits a crash report with `info` and the tail of the log file.
+func (r *CrashReporter) Report(info string) error {
+	report := CrashReport{
+		Tunnel: r.TunnelID,
+		Info:   info,
+		Time:   time.Now().UTC(),
+	}
+
+	if r.LogFile != "" {
+		logs, err := tailFile(r.LogFile, r.logTailSize())
+		if err != nil {
+			logs = fmt.Sprintf("failed to read %s: %v", r.LogFile, err)
+		}
+
+		report.Logs = logs
+	}
+
+	report.Info = r.redact(report.Info)
+	report.Logs = r.redact(report.Logs)
+	r.truncate(&report)
+
+	if err := r.submit(report); err != nil {
+		if r.SpoolDir == "" {
+			return err
+		}
+
+		if spoolErr := r.spool(report); spoolErr != nil {
+			return fmt.Errorf("%w (spooling failed: %v)", err, spoolErr)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// FlushSpool submits the spooled reports, oldest first. Submitted reports are
+// removed from the spool.
+func (r *CrashReporter) FlushSpool() error {
+	if r.SpoolDir == "" {
+		return nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(r.SpoolDir, crashSpoolPattern))
+	if err != nil {
+		return err
+	}
+
+	sort.Strings(files)
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		var report CrashReport
+		if err := json.Unmarshal(data, &report); err != nil {
+			// A corrupted report will never be submitted.
+			_ = os.Remove(file)
+
+			continue
+		}
+
+		if err := r.submit(report); err != nil {
+			return err
+		}
+
+		if err := os.Remove(file); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *CrashReporter) submit(report CrashReport) error {
+	timeout := r.Timeout
+	if timeout <= 0 {
+		timeout = defaultCrashTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return r.Client.reportCrash(ctx, report.Tunnel, report.Info, report.Logs)
+}
+
+func (r *CrashReporter) spool(report CrashReport) error {
+	if err := os.MkdirAll(r.SpoolDir, 0o700); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	name := filepath.Join(r.SpoolDir, fmt.Sprintf("crash-%d.json", report.Time.UnixNano()))
+
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, name)
+}
+
+// redact removes the API key and any other secret detected by the redactor.
+func (r *CrashReporter) redact(s string) string {
+	if r.Client != nil && r.Client.APIKey != "" {
+		s = strings.ReplaceAll(s, r.Client.APIKey, util.Mask)
+	}
+
+	if r.Redactor != nil {
+		return r.Redactor.Redact(s)
+	}
+
+	return util.Redact(s)
+}
+
+// truncate caps the report size, the beginning of the logs is dropped first,
+// then the end of the info.
+func (r *CrashReporter) truncate(report *CrashReport) {
+	maxSize := r.MaxSize
+	if maxSize <= 0 {
+		maxSize = defaultCrashMaxSize
+	}
+
+	if len(report.Info) > maxSize {
+		if maxSize <= len(truncatedMarker) {
+			report.Info = report.Info[:maxSize]
+		} else {
+			report.Info = report.Info[:maxSize-len(truncatedMarker)] + truncatedMarker
+		}
+	}
+
+	if budget := maxSize - len(report.Info); len(report.Logs) > budget {
+		if budget <= len(truncatedMarker) {
+			report.Logs = ""
+		} else {
+			report.Logs = truncatedMarker + report.Logs[len(report.Logs)-budget+len(truncatedMarker):]
+		}
+	}
+}
+
+func (r *CrashReporter) logTailSize() int64 {
+	if r.LogTailSize <= 0 {
+		return defaultCrashLogTailSize
+	}
+
+	return r.LogTailSize
+}
+
+// tailFile returns the last `size` bytes of a file, starting at a line
+// boundary.
+func tailFile(path string, size int64) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	offset := info.Size() - size
+	if offset < 0 {
+		offset = 0
+	}
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return "", err
+	}
+
+	if offset > 0 {
+		if i := strings.IndexByte(string(data), '\n'); i >= 0 {
+			data = data[i+1:]
+		}
+	}
+
+	return string(data), nil
+}
+
+// goroutineDump returns the stack traces of all goroutines.
+func goroutineDump() string {
+	buf := make([]byte, 64*1024)
+
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return string(buf[:n])
+		}
+
+		buf = make([]byte, 2*len(buf))
+	}
+}
@@ -0,0 +1,460 @@
+package rest
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DriftKind is the kind of a Drift.
+type DriftKind int
+
+const (
+	// DriftUnknownField is a response field the type doesn't know.
+	DriftUnknownField DriftKind = iota + 1
+	// DriftMissingField is a required field, i.e. without omitempty, missing
+	// from the response.
+	DriftMissingField
+	// DriftTypeMismatch is a response field of another JSON type.
+	DriftTypeMismatch
+)
+
+// String interface implementation.
+func (k DriftKind) String() string {
+	switch k {
+	case DriftUnknownField:
+		return "unknown field"
+	case DriftMissingField:
+		return "missing field"
+	case DriftTypeMismatch:
+		return "type mismatch"
+	default:
+		return fmt.Sprintf("DriftKind(%d)", int(k))
+	}
+}
+
+// Drift is a difference between a response and the type it's decoded to,
+// e.g. a field added by the server.
+type Drift struct {
+	Operation OperationName
+	// Type is the Go type holding the field, e.g. "rest.TunnelState".
+	Type string
+	Kind DriftKind
+	// Path of the field in the response, e.g. "$[3].metadata.hostname".
+	Path string
+	// Detail of a type mismatch, e.g. "number, expected string".
+	Detail string
+}
+
+// String interface implementation.
+func (d Drift) String() string {
+	s := fmt.Sprintf("%s: %s %s", d.Type, d.Kind, d.Path)
+	if d.Detail != "" {
+		s += " (" + d.Detail + ")"
+	}
+
+	return s
+}
+
+// DriftError is returned with StrictDecoding when a response drifted.
+type DriftError struct {
+	Drifts []Drift
+}
+
+// Error interface implementation.
+func (e *DriftError) Error() string {
+	const shown = 3
+
+	msgs := make([]string, 0, shown)
+
+	for i, d := range e.Drifts {
+		if i == shown {
+			msgs = append(msgs, fmt.Sprintf("and %d more", len(e.Drifts)-shown))
+
+			break
+		}
+
+		msgs = append(msgs, d.String())
+	}
+
+	return "response drifted: " + strings.Join(msgs, ", ")
+}
+
+// DriftReport collects drifts, e.g. with Client.OnDrift set to its Add
+// method. It's safe for concurrent use.
+type DriftReport struct {
+	mu     sync.Mutex
+	drifts []Drift
+}
+
+// Add records `d`.
+func (r *DriftReport) Add(d Drift) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.drifts = append(r.drifts, d)
+}
+
+// Drifts returns the recorded drifts.
+func (r *DriftReport) Drifts() []Drift {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Drift(nil), r.drifts...)
+}
+
+// Summary returns the number of drifts per type that drifted.
+func (r *DriftReport) Summary() map[string]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	summary := make(map[string]int)
+	for _, d := range r.drifts {
+		summary[d.Type]++
+	}
+
+	return summary
+}
+
+// String returns the summary, one type per line, with the distinct drifts
+// of the type, e.g. "rest.TunnelState: unknown field $[0].region".
+func (r *DriftReport) String() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	byType := make(map[string][]string)
+	seen := make(map[string]bool)
+
+	for _, d := range r.drifts {
+		// Array indexes are dropped to report each field once.
+		field := fmt.Sprintf("%s %s", d.Kind, arrayIndex.ReplaceAllString(d.Path, "[]"))
+		if d.Detail != "" {
+			field += " (" + d.Detail + ")"
+		}
+
+		if key := d.Type + field; !seen[key] {
+			seen[key] = true
+			byType[d.Type] = append(byType[d.Type], field)
+		}
+	}
+
+	types := make([]string, 0, len(byType))
+	for t := range byType {
+		types = append(types, t)
+	}
+
+	sort.Strings(types)
+
+	lines := make([]string, 0, len(types))
+	for _, t := range types {
+		lines = append(lines, fmt.Sprintf("%s: %s", t, strings.Join(byType[t], ", ")))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// checkDrift compares the response `data` with type `t`. Drifts are passed to
+// the client OnDrift, and returned as a *DriftError with StrictDecoding.
+// `path` is the path of `data` in the response.
+func (c *Client) checkDrift(op OperationName, data []byte, t reflect.Type, path string) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		// Invalid documents fail to decode anyway.
+		return nil //nolint:nilerr // Not a drift.
+	}
+
+	w := driftWalker{op: op}
+	w.walk(v, t, path, "")
+
+	for _, d := range w.drifts {
+		if c.OnDrift != nil {
+			c.OnDrift(d)
+		}
+	}
+
+	if c.StrictDecoding && len(w.drifts) > 0 {
+		return &DriftError{Drifts: w.drifts}
+	}
+
+	return nil
+}
+
+// driftCheck checks the response `data` to be decoded to type `t`.
+type driftCheck func(data []byte, t reflect.Type, path string) error
+
+func (c *Client) driftCheck(op OperationName) driftCheck {
+	if c.OnDrift == nil && !c.StrictDecoding {
+		return nil
+	}
+
+	return func(data []byte, t reflect.Type, path string) error {
+		return c.checkDrift(op, data, t, path)
+	}
+}
+
+var (
+	arrayIndex = regexp.MustCompile(`\[\d+\]`)
+
+	extraHolderType     = reflect.TypeOf((*extraHolder)(nil)).Elem()
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+type driftWalker struct {
+	op     OperationName
+	drifts []Drift
+}
+
+func (w *driftWalker) add(kind DriftKind, owner, path, detail string) {
+	w.drifts = append(w.drifts, Drift{
+		Operation: w.op,
+		Type:      owner,
+		Kind:      kind,
+		Path:      path,
+		Detail:    detail,
+	})
+}
+
+// walk compares the JSON value `v` with type `t`. `owner` is the type holding
+// the value, if any.
+func (w *driftWalker) walk(v interface{}, t reflect.Type, path, owner string) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	// null is valid for any type, and custom decoding is trusted, unless it
+	// only retains the unknown fields.
+	if v == nil || reflect.PtrTo(t).Implements(jsonUnmarshalerType) && !t.Implements(extraHolderType) {
+		return
+	}
+
+	if _, ok := v.(string); ok && reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		return
+	}
+
+	if owner == "" {
+		owner = t.String()
+	}
+
+	mismatch := func() {
+		w.add(DriftTypeMismatch, owner, path, fmt.Sprintf("%s, expected %s", jsonKind(v), t))
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			mismatch()
+
+			return
+		}
+
+		w.walkStruct(obj, t, path)
+	case reflect.Map:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			mismatch()
+
+			return
+		}
+
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			w.walk(obj[k], t.Elem(), fmt.Sprintf("%s[%q]", path, k), owner)
+		}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			if _, ok := v.(string); !ok {
+				mismatch()
+			}
+
+			return
+		}
+
+		arr, ok := v.([]interface{})
+		if !ok {
+			mismatch()
+
+			return
+		}
+
+		for i, e := range arr {
+			w.walk(e, t.Elem(), fmt.Sprintf("%s[%d]", path, i), owner)
+		}
+	case reflect.String:
+		if _, ok := v.(string); !ok {
+			mismatch()
+		}
+	case reflect.Bool:
+		if _, ok := v.(bool); !ok {
+			mismatch()
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		if _, ok := v.(json.Number); !ok {
+			mismatch()
+		}
+	case reflect.Interface:
+	default:
+		mismatch()
+	}
+}
+
+func (w *driftWalker) walkStruct(obj map[string]interface{}, t reflect.Type, path string) {
+	owner := t.String()
+	fields := jsonFields(t)
+
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	found := make(map[string]bool, len(keys))
+
+	for _, k := range keys {
+		f, ok := fields.lookup(k)
+		if !ok {
+			w.add(DriftUnknownField, owner, path+"."+k, "")
+
+			continue
+		}
+
+		found[f.name] = true
+
+		w.walk(obj[k], f.typ, path+"."+k, f.owner)
+	}
+
+	for _, f := range fields {
+		if f.required && !found[f.name] {
+			w.add(DriftMissingField, f.owner, path+"."+f.name, "")
+		}
+	}
+}
+
+// jsonField is a field decoded by encoding/json.
+type jsonField struct {
+	name     string
+	typ      reflect.Type
+	required bool
+	// owner is the struct type declaring the field, e.g. an embedded one.
+	owner string
+}
+
+type jsonFieldList []jsonField
+
+// lookup finds the field of JSON key `key`, case-insensitively as
+// encoding/json does.
+func (l jsonFieldList) lookup(key string) (jsonField, bool) {
+	for _, f := range l {
+		if f.name == key {
+			return f, true
+		}
+	}
+
+	for _, f := range l {
+		if strings.EqualFold(f.name, key) {
+			return f, true
+		}
+	}
+
+	return jsonField{}, false
+}
+
+// jsonFieldsCache caches the fields by struct type, they're looked up for
+// every decoded value, e.g. each streamed tunnel state.
+var jsonFieldsCache sync.Map // map[reflect.Type]jsonFieldList
+
+// jsonFields returns the fields of struct type `t`, including the fields of
+// embedded structs. The list is shared, and must not be modified.
+func jsonFields(t reflect.Type) jsonFieldList {
+	if cached, ok := jsonFieldsCache.Load(t); ok {
+		if fields, ok := cached.(jsonFieldList); ok {
+			return fields
+		}
+	}
+
+	fields := typeJSONFields(t)
+	jsonFieldsCache.Store(t, fields)
+
+	return fields
+}
+
+// typeJSONFields returns the fields of struct type `t`, see jsonFields.
+func typeJSONFields(t reflect.Type) jsonFieldList {
+	var fields jsonFieldList
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(tag, ",")
+
+		ft := sf.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+
+		if sf.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			fields = append(fields, jsonFields(ft)...)
+
+			continue
+		}
+
+		if !sf.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = sf.Name
+		}
+
+		fields = append(fields, jsonField{
+			name:     name,
+			typ:      sf.Type,
+			required: !strings.Contains(","+opts+",", ",omitempty,"),
+			owner:    t.String(),
+		})
+	}
+
+	return fields
+}
+
+// jsonKind returns the JSON type of a decoded value.
+func jsonKind(v interface{}) string {
+	switch v.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	case bool:
+		return "boolean"
+	default:
+		return "null"
+	}
+}
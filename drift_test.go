@@ -0,0 +1,123 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	assertLib "github.com/stretchr/testify/assert"
+)
+
+const fullTunnelStateJSON = `{"creation_time": 1, "host": "h", "id": "t0", "owner": "o", "shared_tunnel": false,` +
+	` "is_ready": true, "status": "running", "tunnel_identifier": "pool"}`
+
+func TestDriftNone(t *testing.T) {
+	assert := assertLib.New(t)
+
+	server := jsonServer(fullTunnelStateJSON)
+	defer server.Close()
+
+	report := &DriftReport{}
+	c := &Client{BaseURL: server.URL, User: tunnelUser, OnDrift: report.Add, StrictDecoding: true}
+
+	state, err := c.TunnelState(context.Background(), "t0")
+	assert.NoError(err)
+	assert.Equal("t0", state.ID)
+	assert.Empty(report.Drifts())
+}
+
+func TestDriftReport(t *testing.T) {
+	assert := assertLib.New(t)
+
+	server := jsonServer(`[` +
+		`{"creation_time": 1, "host": "h", "id": "t0", "owner": "o", "shared_tunnel": false, "is_ready": true,` +
+		` "status": "running", "tunnel_identifier": "pool", "datacenter": "us-west",` +
+		` "metadata": {"hostname": 1, "build": "b", "command": "c", "command_args": "", "git_version": "",` +
+		` "nofile_limit": 0, "platform": "", "release": "", "arch": "amd64"}},` +
+		`{"creation_time": "1", "host": "h", "ID": "t1", "owner": "o", "shared_tunnel": false, "is_ready": true,` +
+		` "status": "running", "datacenter": "eu-central"}` +
+		`]`)
+	defer server.Close()
+
+	report := &DriftReport{}
+	c := &Client{BaseURL: server.URL, User: tunnelUser, OnDrift: report.Add}
+
+	// Lenient decoding fails on type mismatches, as before.
+	_, err := c.ListTunnelStates()
+	assert.Error(err)
+
+	assert.Equal([]Drift{
+		{OperationListTunnels, "rest.TunnelState", DriftUnknownField, "$[0].datacenter", ""},
+		{OperationListTunnels, "rest.Metadata", DriftUnknownField, "$[0].metadata.arch", ""},
+		{OperationListTunnels, "rest.Metadata", DriftTypeMismatch, "$[0].metadata.hostname", "number, expected string"},
+		{OperationListTunnels, "rest.TunnelState", DriftTypeMismatch, "$[1].creation_time", "string, expected int"},
+		{OperationListTunnels, "rest.TunnelState", DriftUnknownField, "$[1].datacenter", ""},
+		{OperationListTunnels, "rest.TunnelState", DriftMissingField, "$[1].tunnel_identifier", ""},
+	}, report.Drifts())
+
+	assert.Equal(map[string]int{"rest.Metadata": 2, "rest.TunnelState": 4}, report.Summary())
+	assert.Equal("rest.Metadata: unknown field $[].metadata.arch, "+
+		"type mismatch $[].metadata.hostname (number, expected string)\n"+
+		"rest.TunnelState: unknown field $[].datacenter, type mismatch $[].creation_time (string, expected int), "+
+		"missing field $[].tunnel_identifier", report.String())
+}
+
+func TestDriftStrict(t *testing.T) {
+	assert := assertLib.New(t)
+
+	server := jsonServer(`{"latest_version": "5.0", "info_url": "", "download_url": "", "sha1": "",` +
+		` "downloads": {"linux": {"download_url": "", "sha1": "", "size": 10}, "osx": {"download_url": "", "sha1": ""}}}`)
+	defer server.Close()
+
+	c := &Client{BaseURL: server.URL, StrictDecoding: true}
+
+	_, err := c.GetVersions("linux", "5.0", false)
+
+	var dE *DriftError
+	assert.Truef(errors.As(err, &dE), "expected a *DriftError, got %v", err)
+	assert.Equal([]Drift{
+		{OperationGetVersions, "rest.ClientDownloadInfo", DriftUnknownField, "$.downloads.linux.size", ""},
+	}, dE.Drifts)
+	assert.Contains(err.Error(), "response drifted: rest.ClientDownloadInfo: unknown field $.downloads.linux.size")
+}
+
+func TestDriftEmbedded(t *testing.T) {
+	assert := assertLib.New(t)
+
+	server := jsonServer(`{"id": "t0", "messages": {"info": ["hi"]}, "extra": 1}`)
+	defer server.Close()
+
+	report := &DriftReport{}
+	c := &Client{BaseURL: server.URL, User: tunnelUser, OnDrift: report.Add}
+
+	tunnel, err := c.CreateTunnelV5(context.Background(), &CreateTunnelRequestV5{}, time.Minute)
+	assert.NoError(err)
+	assert.Equal("t0", tunnel.ID)
+
+	summary := report.Summary()
+	assert.Equal(1, summary["rest.TunnelStateWithMessages"])
+	assert.Equal(7, summary["rest.TunnelState"])
+}
+
+func TestDriftStream(t *testing.T) {
+	assert := assertLib.New(t)
+
+	server := jsonServer(`{"alice": [` + fullTunnelStateJSON + `, {"id": "t1"}]}`)
+	defer server.Close()
+
+	c := &Client{BaseURL: server.URL, User: tunnelUser, StrictDecoding: true}
+
+	var ids []string
+
+	err := c.WalkSharedTunnelStates(context.Background(), func(_ string, s TunnelState) error {
+		ids = append(ids, s.ID)
+
+		return nil
+	})
+
+	var dE *DriftError
+	assert.Truef(errors.As(err, &dE), "expected a *DriftError, got %v", err)
+	assert.Equal(`$["alice"][1].creation_time`, dE.Drifts[0].Path)
+	assert.Equal([]string{"t0"}, ids)
+}
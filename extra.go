@@ -0,0 +1,204 @@
+package rest
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/saucelabs/tunnelrest-go/region"
+)
+
+// extraHolder is implemented by types retaining the response fields unknown
+// to them, decoded by UnmarshalJSON. Their known fields are still checked for
+// drift.
+type extraHolder interface {
+	extraFields() map[string]json.RawMessage
+}
+
+// unmarshalExtra decodes `data` into `v`, a pointer to a struct without a
+// custom decoding, and returns the fields of `data` unknown to `v`.
+func unmarshalExtra(data []byte, v interface{}) (map[string]json.RawMessage, error) {
+	if err := json.Unmarshal(data, v); err != nil {
+		return nil, err
+	}
+
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+
+	fields := jsonFields(reflect.TypeOf(v).Elem())
+
+	for k := range all {
+		if _, ok := fields.lookup(k); ok {
+			delete(all, k)
+		}
+	}
+
+	if len(all) == 0 {
+		return nil, nil
+	}
+
+	return all, nil
+}
+
+// marshalExtra encodes `v`, a struct without a custom encoding, along with
+// the `extra` fields it doesn't set.
+func marshalExtra(v interface{}, extra map[string]json.RawMessage) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil || len(extra) == 0 {
+		return data, err
+	}
+
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+
+	for k, raw := range extra {
+		if _, ok := all[k]; !ok {
+			all[k] = raw
+		}
+	}
+
+	return json.Marshal(all)
+}
+
+// The plain types have the fields, but not the methods, of their counterpart.
+type (
+	plainTunnelState TunnelState
+	plainSCUpdates   SCUpdates
+	plainSCVersions  SCVersions
+
+	plainTunnelStateWithMessages struct {
+		plainTunnelState
+		Messages SCMessages `json:"messages,omitempty"`
+	}
+
+	// The region shadows the TunnelState one, which is encoded as
+	// "tunnel_region" instead.
+	plainRegionalTunnelState struct {
+		plainTunnelState
+		Region       region.Region `json:"region"`
+		TunnelRegion string        `json:"tunnel_region,omitempty"`
+	}
+)
+
+func (s TunnelState) extraFields() map[string]json.RawMessage { return s.Extra }
+
+// MarshalJSON interface implementation. Extra fields are encoded back.
+func (s TunnelState) MarshalJSON() ([]byte, error) {
+	return marshalExtra(plainTunnelState(s), s.Extra)
+}
+
+// UnmarshalJSON interface implementation. Unknown fields are kept in Extra.
+func (s *TunnelState) UnmarshalJSON(data []byte) error {
+	var plain plainTunnelState
+
+	extra, err := unmarshalExtra(data, &plain)
+	if err != nil {
+		return err
+	}
+
+	*s = TunnelState(plain)
+	s.Extra = extra
+
+	return nil
+}
+
+// MarshalJSON interface implementation. Extra fields are encoded back.
+func (t TunnelStateWithMessages) MarshalJSON() ([]byte, error) {
+	plain := plainTunnelStateWithMessages{
+		plainTunnelState: plainTunnelState(t.TunnelState),
+		Messages:         t.Messages,
+	}
+
+	return marshalExtra(plain, t.Extra)
+}
+
+// UnmarshalJSON interface implementation. Unknown fields are kept in Extra.
+func (t *TunnelStateWithMessages) UnmarshalJSON(data []byte) error {
+	var plain plainTunnelStateWithMessages
+
+	extra, err := unmarshalExtra(data, &plain)
+	if err != nil {
+		return err
+	}
+
+	t.TunnelState = TunnelState(plain.plainTunnelState)
+	t.Extra = extra
+	t.Messages = plain.Messages
+
+	return nil
+}
+
+// MarshalJSON interface implementation. Extra fields are encoded back.
+func (s RegionalTunnelState) MarshalJSON() ([]byte, error) {
+	plain := plainRegionalTunnelState{
+		plainTunnelState: plainTunnelState(s.TunnelState),
+		Region:           s.Region,
+		TunnelRegion:     s.TunnelState.Region,
+	}
+
+	return marshalExtra(plain, s.Extra)
+}
+
+// UnmarshalJSON interface implementation. Unknown fields are kept in Extra.
+func (s *RegionalTunnelState) UnmarshalJSON(data []byte) error {
+	var plain plainRegionalTunnelState
+
+	extra, err := unmarshalExtra(data, &plain)
+	if err != nil {
+		return err
+	}
+
+	s.TunnelState = TunnelState(plain.plainTunnelState)
+	s.TunnelState.Region = plain.TunnelRegion
+	s.Extra = extra
+	s.Region = plain.Region
+
+	return nil
+}
+
+func (u SCUpdates) extraFields() map[string]json.RawMessage { return u.Extra }
+
+// MarshalJSON interface implementation. Extra fields are encoded back.
+func (u SCUpdates) MarshalJSON() ([]byte, error) {
+	return marshalExtra(plainSCUpdates(u), u.Extra)
+}
+
+// UnmarshalJSON interface implementation. Unknown fields are kept in Extra.
+func (u *SCUpdates) UnmarshalJSON(data []byte) error {
+	var plain plainSCUpdates
+
+	extra, err := unmarshalExtra(data, &plain)
+	if err != nil {
+		return err
+	}
+
+	*u = SCUpdates(plain)
+	u.Extra = extra
+
+	return nil
+}
+
+func (v SCVersions) extraFields() map[string]json.RawMessage { return v.Extra }
+
+// MarshalJSON interface implementation. Extra fields are encoded back.
+func (v SCVersions) MarshalJSON() ([]byte, error) {
+	return marshalExtra(plainSCVersions(v), v.Extra)
+}
+
+// UnmarshalJSON interface implementation. Unknown fields are kept in Extra.
+func (v *SCVersions) UnmarshalJSON(data []byte) error {
+	var plain plainSCVersions
+
+	extra, err := unmarshalExtra(data, &plain)
+	if err != nil {
+		return err
+	}
+
+	*v = SCVersions(plain)
+	v.Extra = extra
+
+	return nil
+}
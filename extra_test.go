@@ -0,0 +1,85 @@
+package rest
+
+import (
+	"encoding/json"
+	"testing"
+
+	assertLib "github.com/stretchr/testify/assert"
+)
+
+func TestTunnelStateExtra(t *testing.T) {
+	assert := assertLib.New(t)
+
+	const data = `{"id": "t0", "status": "running", "protocol": "h2c", "region": "us-west",` +
+		` "last_connected": 1700000000, "datacenter": "dc1", "labels": {"ci": true}}`
+
+	var s TunnelState
+	assert.NoError(json.Unmarshal([]byte(data), &s))
+	assert.Equal("t0", s.ID)
+	assert.Equal(H2CProtocol, s.Protocol)
+	assert.Equal("us-west", s.Region)
+	assert.Equal(1700000000, s.LastConnected)
+	assert.Equal(map[string]json.RawMessage{
+		"datacenter": json.RawMessage(`"dc1"`),
+		"labels":     json.RawMessage(`{"ci": true}`),
+	}, s.Extra)
+
+	encoded, err := json.Marshal(s)
+	assert.NoError(err)
+
+	var roundTrip TunnelState
+	assert.NoError(json.Unmarshal(encoded, &roundTrip))
+	assert.Equal(s.ID, roundTrip.ID)
+	assert.JSONEq(`"dc1"`, string(roundTrip.Extra["datacenter"]))
+	assert.JSONEq(`{"ci": true}`, string(roundTrip.Extra["labels"]))
+
+	// Without extra fields, the encoding is unchanged.
+	s.Extra = nil
+	encoded, err = json.Marshal(s)
+	assert.NoError(err)
+	plain, err := json.Marshal(plainTunnelState(s))
+	assert.NoError(err)
+	assert.Equal(string(plain), string(encoded))
+}
+
+func TestTunnelStateWithMessagesExtra(t *testing.T) {
+	assert := assertLib.New(t)
+
+	const data = `{"id": "t0", "messages": {"warning": ["w"]}, "datacenter": "dc1"}`
+
+	var s TunnelStateWithMessages
+	assert.NoError(json.Unmarshal([]byte(data), &s))
+	assert.Equal("t0", s.ID)
+	assert.Equal([]string{"w"}, s.Messages.Warning)
+	assert.Equal(map[string]json.RawMessage{"datacenter": json.RawMessage(`"dc1"`)}, s.Extra)
+
+	encoded, err := json.Marshal(s)
+	assert.NoError(err)
+	assert.JSONEq(`{"id": "t0", "creation_time": 0, "host": "", "owner": "", "shared_tunnel": false,`+
+		` "is_ready": false, "status": "", "tunnel_identifier": "", "metadata": {"build": "", "command": "",`+
+		` "command_args": "", "git_version": "", "hostname": "", "nofile_limit": 0, "platform": "", "release": ""},`+
+		` "messages": {"warning": ["w"]}, "datacenter": "dc1"}`, string(encoded))
+}
+
+func TestSCUpdatesAndVersionsExtra(t *testing.T) {
+	assert := assertLib.New(t)
+
+	var u SCUpdates
+	assert.NoError(json.Unmarshal([]byte(`{"info": ["i"], "configuration": {"start_timeout": 1}, "motd": "hi"}`), &u))
+	assert.Equal([]string{"i"}, u.Info)
+	assert.Equal(1, u.Configuration.StartTimeout)
+	assert.Equal(map[string]json.RawMessage{"motd": json.RawMessage(`"hi"`)}, u.Extra)
+
+	encoded, err := json.Marshal(u)
+	assert.NoError(err)
+	assert.Contains(string(encoded), `"motd":"hi"`)
+
+	var v SCVersions
+	assert.NoError(json.Unmarshal([]byte(`{"latest_version": "5.0", "eol": "2030-01-01"}`), &v))
+	assert.Equal("5.0", v.Latest)
+	assert.Equal(map[string]json.RawMessage{"eol": json.RawMessage(`"2030-01-01"`)}, v.Extra)
+
+	encoded, err = json.Marshal(&v)
+	assert.NoError(err)
+	assert.Contains(string(encoded), `"eol":"2030-01-01"`)
+}
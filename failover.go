@@ -0,0 +1,213 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/saucelabs/tunnelrest-go/region"
+)
+
+const (
+	defaultFailoverTimeout = 30 * time.Second
+
+	// FailoverShutdownReason is sent when a tunnel created by a failed
+	// attempt is terminated.
+	FailoverShutdownReason = "failover"
+)
+
+var ErrNoRegions = errors.New("no regions to create the tunnel in")
+
+// FailoverPolicy defines when tunnel creation moves on to the next region.
+type FailoverPolicy struct {
+	// ShouldFailover reports whether the creation error allows trying the
+	// next region. Defaults to IsFailoverError.
+	ShouldFailover func(error) bool
+	// Timeout of the creation in a single region. Defaults to 30s.
+	Timeout time.Duration
+}
+
+// FailoverAttempt is a failed tunnel creation attempt.
+type FailoverAttempt struct {
+	Region   region.Region
+	Err      error
+	Duration time.Duration
+	// Orphans are the IDs of the tunnels the attempt created nevertheless,
+	// e.g. when the response timed out, that were shut down.
+	Orphans []string
+	// CleanupErr is the error of looking up or shutting down the orphans.
+	CleanupErr error
+}
+
+// FailoverResult is the outcome of CreateTunnelV5WithFailover.
+type FailoverResult struct {
+	// Tunnel is the created tunnel. It's also set along with a
+	// *FatalMessageError, the tunnel is then left to the caller to shut down.
+	Tunnel TunnelStateWithMessages
+	// Region the tunnel was created in.
+	Region region.Region
+	// Attempts that failed before the tunnel was created, in order.
+	Attempts []FailoverAttempt
+}
+
+// FailoverError is returned when the tunnel couldn't be created in any region.
+type FailoverError struct {
+	Attempts []FailoverAttempt
+}
+
+// Error interface implementation.
+func (e *FailoverError) Error() string {
+	msgs := make([]string, len(e.Attempts))
+	for i, a := range e.Attempts {
+		msgs[i] = fmt.Sprintf("%s: %v", a.Region, a.Err)
+	}
+
+	return fmt.Sprintf("failed to create tunnel in %d region(s): %s", len(e.Attempts), strings.Join(msgs, "; "))
+}
+
+// Unwrap interface implementation, returns the error of the last attempt.
+func (e *FailoverError) Unwrap() error {
+	if len(e.Attempts) == 0 {
+		return nil
+	}
+
+	return e.Attempts[len(e.Attempts)-1].Err
+}
+
+// IsFailoverError reports whether `err` is a server side or network error,
+// i.e. a different region may succeed. Client errors, e.g. invalid
+// credentials, are not.
+func IsFailoverError(err error) bool {
+	var cE *ClientError
+	if !errors.As(err, &cE) {
+		return errors.Is(err, context.DeadlineExceeded)
+	}
+
+	switch {
+	case cE.StatusCode == 0,
+		cE.StatusCode == http.StatusRequestTimeout,
+		cE.StatusCode == http.StatusTooManyRequests,
+		cE.StatusCode >= http.StatusInternalServerError:
+		return true
+	default:
+		return false
+	}
+}
+
+// CreateTunnelV5WithFailover creates a Sauce Connect 5 tunnel in the first of
+// `regions` that succeeds. Every region gets a copy of `template` with the
+// region URL as BaseURL. Creation stops at the first error the policy doesn't
+// fail over on, or when `ctx` is done.
+//
+// A failed attempt may still have created the tunnel, e.g. if the response
+// timed out. Before moving on to the next region, the tunnels with the request
+// identifier created since the attempt started are shut down. Without an
+// identifier they can't be told apart and are left running.
+func CreateTunnelV5WithFailover(
+	ctx context.Context,
+	template *Client,
+	regions []region.Region,
+	req *CreateTunnelRequestV5,
+	policy FailoverPolicy,
+) (FailoverResult, error) {
+	var result FailoverResult
+
+	if len(regions) == 0 {
+		return result, ErrNoRegions
+	}
+
+	shouldFailover := policy.ShouldFailover
+	if shouldFailover == nil {
+		shouldFailover = IsFailoverError
+	}
+
+	timeout := policy.Timeout
+	if timeout <= 0 {
+		timeout = defaultFailoverTimeout
+	}
+
+	for _, r := range regions {
+		c := *template
+		c.BaseURL = r.URL
+
+		start := time.Now()
+
+		tunnel, err := c.CreateTunnelV5(ctx, req, timeout)
+
+		// A FatalMessageError is returned along with the created tunnel.
+		if tunnel.ID != "" {
+			result.Tunnel = tunnel
+			result.Region = r
+
+			return result, err
+		}
+
+		attempt := FailoverAttempt{
+			Region:   r,
+			Err:      err,
+			Duration: time.Since(start),
+		}
+
+		if ctx.Err() != nil || !shouldFailover(err) {
+			result.Attempts = append(result.Attempts, attempt)
+
+			break
+		}
+
+		attempt.Orphans, attempt.CleanupErr = shutdownOrphans(ctx, &c, req.TunnelIdentifier, start, timeout)
+		result.Attempts = append(result.Attempts, attempt)
+	}
+
+	return result, &FailoverError{Attempts: result.Attempts}
+}
+
+// shutdownOrphans shuts down the running tunnels with `identifier` created
+// since `start`, and returns their IDs.
+func shutdownOrphans(
+	ctx context.Context,
+	c *Client,
+	identifier string,
+	start time.Time,
+	timeout time.Duration,
+) ([]string, error) {
+	if identifier == "" {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	states, err := c.listTunnels(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// The creation time has a one second resolution.
+	since := start.Truncate(time.Second).Unix()
+
+	var (
+		ids      []string
+		firstErr error
+	)
+
+	for _, s := range states {
+		if s.TunnelIdentifier != identifier || isTerminated(s) || int64(s.CreationTime) < since {
+			continue
+		}
+
+		if _, err := c.ShutdownTunnel(ctx, s.ID, FailoverShutdownReason, false); err != nil && !isNotFound(err) {
+			if firstErr == nil {
+				firstErr = err
+			}
+
+			continue
+		}
+
+		ids = append(ids, s.ID)
+	}
+
+	return ids, firstErr
+}
@@ -0,0 +1,170 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/saucelabs/tunnelrest-go/region"
+	assertLib "github.com/stretchr/testify/assert"
+)
+
+func TestCreateTunnelV5WithFailover(t *testing.T) {
+	assert := assertLib.New(t)
+
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer slow.Close()
+
+	api, healthy := newFakeTunnelAPI()
+	defer healthy.Close()
+
+	regions := []region.Region{
+		{Name: "us-west", URL: unavailable.URL},
+		{Name: "us-east", URL: slow.URL},
+		{Name: "eu-central", URL: healthy.URL},
+	}
+
+	result, err := CreateTunnelV5WithFailover(
+		context.Background(),
+		&Client{User: tunnelUser, APIKey: "password"},
+		regions,
+		&CreateTunnelRequestV5{TunnelIdentifier: "ci"},
+		FailoverPolicy{Timeout: 50 * time.Millisecond},
+	)
+	assert.NoError(err)
+	assert.Equal("eu-central", result.Region.Name)
+	assert.Equal("ci", result.Tunnel.TunnelIdentifier)
+	assert.Equal(1, api.running())
+
+	assert.Len(result.Attempts, 2)
+	assert.Equal("us-west", result.Attempts[0].Region.Name)
+	assert.Equal("us-east", result.Attempts[1].Region.Name)
+
+	var cE *ClientError
+	assert.True(errors.As(result.Attempts[1].Err, &cE))
+	assert.Equal(http.StatusRequestTimeout, cE.StatusCode)
+}
+
+func TestCreateTunnelV5WithFailoverStops(t *testing.T) {
+	assert := assertLib.New(t)
+
+	unauthorized := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	}))
+	defer unauthorized.Close()
+
+	api, healthy := newFakeTunnelAPI()
+	defer healthy.Close()
+
+	result, err := CreateTunnelV5WithFailover(
+		context.Background(),
+		&Client{User: tunnelUser},
+		[]region.Region{{Name: "us-west", URL: unauthorized.URL}, {Name: "eu-central", URL: healthy.URL}},
+		&CreateTunnelRequestV5{TunnelIdentifier: "ci"},
+		FailoverPolicy{},
+	)
+
+	var failoverErr *FailoverError
+	assert.True(errors.As(err, &failoverErr), "FailoverError is expected, got %v", err)
+	assert.Len(result.Attempts, 1)
+	assert.Equal(0, api.running())
+
+	var cE *ClientError
+	assert.True(errors.As(err, &cE))
+	assert.Equal(http.StatusUnauthorized, cE.StatusCode)
+}
+
+func TestCreateTunnelV5WithFailoverShutsDownOrphans(t *testing.T) {
+	assert := assertLib.New(t)
+
+	// The tunnel is created, but the response times out.
+	slowAPI, _ := newFakeTunnelAPI()
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			slowAPI.ServeHTTP(w, r)
+
+			return
+		}
+
+		slowAPI.ServeHTTP(httptest.NewRecorder(), r)
+
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer slow.Close()
+
+	api, healthy := newFakeTunnelAPI()
+	defer healthy.Close()
+
+	result, err := CreateTunnelV5WithFailover(
+		context.Background(),
+		&Client{User: tunnelUser, APIKey: "password"},
+		[]region.Region{{Name: "us-east", URL: slow.URL}, {Name: "eu-central", URL: healthy.URL}},
+		&CreateTunnelRequestV5{TunnelIdentifier: "ci"},
+		FailoverPolicy{Timeout: 50 * time.Millisecond},
+	)
+	assert.NoError(err)
+	assert.Equal("eu-central", result.Region.Name)
+	assert.Equal(1, api.running())
+
+	assert.Len(result.Attempts, 1)
+	assert.NoError(result.Attempts[0].CleanupErr)
+	assert.Len(result.Attempts[0].Orphans, 1)
+	assert.Equal(0, slowAPI.running())
+
+	for _, s := range slowAPI.tunnels {
+		assert.Equal(FailoverShutdownReason, s.ShutdownReason)
+	}
+}
+
+func TestCreateTunnelV5WithFailoverFatalMessage(t *testing.T) {
+	assert := assertLib.New(t)
+
+	api, _ := newFakeTunnelAPI()
+	fatal := httptest.NewServer(fatalOnCreate(api))
+	defer fatal.Close()
+
+	_, healthy := newFakeTunnelAPI()
+	defer healthy.Close()
+
+	result, err := CreateTunnelV5WithFailover(
+		context.Background(),
+		&Client{User: tunnelUser, APIKey: "password", FatalAsError: true},
+		[]region.Region{{Name: "us-west", URL: fatal.URL}, {Name: "eu-central", URL: healthy.URL}},
+		&CreateTunnelRequestV5{TunnelIdentifier: "ci"},
+		FailoverPolicy{},
+	)
+
+	var fatalErr *FatalMessageError
+	assert.ErrorAs(err, &fatalErr)
+	assert.Equal("us-west", result.Region.Name)
+	assert.NotEmpty(result.Tunnel.ID)
+	assert.Equal(1, api.running())
+}
+
+func TestIsFailoverError(t *testing.T) {
+	assert := assertLib.New(t)
+
+	assert.True(IsFailoverError(&ClientError{StatusCode: http.StatusBadGateway}))
+	assert.True(IsFailoverError(&ClientError{StatusCode: http.StatusTooManyRequests}))
+	assert.True(IsFailoverError(&ClientError{Err: errors.New("connection refused")}))
+	assert.False(IsFailoverError(&ClientError{StatusCode: http.StatusBadRequest}))
+	assert.False(IsFailoverError(errors.New("other")))
+}
@@ -0,0 +1,135 @@
+package rest
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FeatureGates are experimental features, parsed from lists such as
+// ClientConfiguration.Experimental. Entries have the following forms:
+//
+//   - "name" enables the feature.
+//   - "-name" disables the feature.
+//   - "name=value" enables the feature with a value. Boolean false values,
+//     e.g. "name=false", disable the feature.
+//
+// Later entries take precedence. The zero value has no feature enabled.
+type FeatureGates struct {
+	gates map[string]featureGate
+}
+
+type featureGate struct {
+	enabled bool
+	value   string
+}
+
+// ParseFeatureGates parses `entries`. Empty entries are ignored, names are
+// case insensitive.
+func ParseFeatureGates(entries []string) FeatureGates {
+	return FeatureGates{}.Override(entries...)
+}
+
+// FeatureGates returns the feature gates of the Experimental list.
+func (c ClientConfiguration) FeatureGates() FeatureGates {
+	return ParseFeatureGates(c.Experimental)
+}
+
+// Override returns a copy of the gates with `entries` applied, e.g. local
+// overrides of the server provided gates.
+func (g FeatureGates) Override(entries ...string) FeatureGates {
+	gates := make(map[string]featureGate, len(g.gates)+len(entries))
+	for name, gate := range g.gates {
+		gates[name] = gate
+	}
+
+	for _, e := range entries {
+		e = strings.TrimSpace(e)
+
+		if strings.HasPrefix(e, "-") {
+			if name := normalizeFeature(e[1:]); name != "" {
+				gates[name] = featureGate{}
+			}
+
+			continue
+		}
+
+		name, value, hasValue := strings.Cut(e, "=")
+		if name = normalizeFeature(name); name == "" {
+			continue
+		}
+
+		gate := featureGate{enabled: true, value: strings.TrimSpace(value)}
+		if hasValue {
+			if b, err := strconv.ParseBool(gate.value); err == nil && !b {
+				gate.enabled = false
+			}
+		}
+
+		gates[name] = gate
+	}
+
+	return FeatureGates{gates: gates}
+}
+
+// Enabled returns whether the feature `name` is enabled.
+func (g FeatureGates) Enabled(name string) bool {
+	return g.gates[normalizeFeature(name)].enabled
+}
+
+// Value returns the value of the enabled feature `name`, if any.
+func (g FeatureGates) Value(name string) (string, bool) {
+	gate := g.gates[normalizeFeature(name)]
+	if !gate.enabled || gate.value == "" {
+		return "", false
+	}
+
+	return gate.value, true
+}
+
+// Names returns the sorted names of the enabled features.
+func (g FeatureGates) Names() []string {
+	var names []string
+
+	for name, gate := range g.gates {
+		if gate.enabled {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// String interface implementation. The result can be parsed back with
+// ParseFeatureGates.
+func (g FeatureGates) String() string {
+	names := make([]string, 0, len(g.gates))
+	for name := range g.gates {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	entries := make([]string, len(names))
+
+	for i, name := range names {
+		gate := g.gates[name]
+
+		switch {
+		case !gate.enabled:
+			entries[i] = "-" + name
+		case gate.value != "":
+			entries[i] = name + "=" + gate.value
+		default:
+			entries[i] = name
+		}
+	}
+
+	return strings.Join(entries, ",")
+}
+
+func normalizeFeature(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
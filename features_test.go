@@ -0,0 +1,53 @@
+package rest
+
+import (
+	"testing"
+
+	assertLib "github.com/stretchr/testify/assert"
+)
+
+func TestFeatureGates(t *testing.T) {
+	assert := assertLib.New(t)
+
+	g := ClientConfiguration{
+		Experimental: []string{"http2", "-proxy", "dns=8.8.8.8", "compression=false", " ", "HTTP3"},
+	}.FeatureGates()
+
+	assert.True(g.Enabled("http2"))
+	assert.True(g.Enabled("http3"))
+	assert.False(g.Enabled("proxy"))
+	assert.False(g.Enabled("compression"))
+	assert.False(g.Enabled("unknown"))
+	assert.True(g.Enabled("dns"))
+
+	v, ok := g.Value("dns")
+	assert.True(ok)
+	assert.Equal("8.8.8.8", v)
+
+	_, ok = g.Value("http2")
+	assert.False(ok)
+
+	assert.Equal([]string{"dns", "http2", "http3"}, g.Names())
+	assert.Equal("-compression,dns=8.8.8.8,http2,http3,-proxy", g.String())
+}
+
+func TestFeatureGatesOverride(t *testing.T) {
+	assert := assertLib.New(t)
+
+	server := ParseFeatureGates([]string{"http2", "dns=8.8.8.8"})
+	local := server.Override("-http2", "dns=1.1.1.1", "proxy")
+
+	assert.False(local.Enabled("http2"))
+	assert.True(local.Enabled("proxy"))
+
+	v, _ := local.Value("dns")
+	assert.Equal("1.1.1.1", v)
+
+	// The original gates are left unchanged.
+	assert.True(server.Enabled("http2"))
+	assert.False(server.Enabled("proxy"))
+
+	var zero FeatureGates
+	assert.False(zero.Enabled("http2"))
+	assert.Equal("", zero.String())
+}
@@ -0,0 +1,217 @@
+// Package health serves liveness, readiness and status endpoints for a
+// running tunnel.
+//
+// The tunnel state is polled in the background, probes are served from the
+// cached state and never reach the REST API.
+//
+// Usage:
+//
+//	checker := &health.Checker{Client: client, TunnelID: tunnel.ID}
+//	go checker.Run(ctx)
+//	http.Handle("/", checker)
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	rest "github.com/saucelabs/tunnelrest-go"
+)
+
+const defaultInterval = 10 * time.Second
+
+// Status is the cached tunnel health, as served by /status.
+type Status struct {
+	TunnelID string `json:"tunnel_id"`
+	// Live is false once the tunnel is shut down.
+	Live bool `json:"live"`
+	// Ready is true if the tunnel is ready, and the cached state is fresh.
+	Ready bool `json:"ready"`
+	// Reasons why the tunnel isn't ready.
+	Reasons []string `json:"reasons,omitempty"`
+
+	TunnelStatus   string `json:"tunnel_status,omitempty"`
+	IsReady        bool   `json:"is_ready"`
+	ShutdownReason string `json:"shutdown_reason,omitempty"`
+
+	// APIReachable is false if the last refresh failed.
+	APIReachable bool `json:"api_reachable"`
+	// LastError is the error of the last refresh, if it failed.
+	LastError string `json:"last_error,omitempty"`
+	// LastRefresh is the time of the last successful refresh, nil until
+	// then.
+	LastRefresh *time.Time `json:"last_refresh,omitempty"`
+	// LastClientStatus is the time of the last successful client status
+	// update, nil until then.
+	LastClientStatus *time.Time `json:"last_client_status,omitempty"`
+}
+
+// Checker caches the state of a tunnel, and serves:
+//
+//   - /healthz: 200 while the tunnel isn't shut down, 503 otherwise.
+//   - /readyz: 200 if the tunnel is ready, 503 otherwise.
+//   - /status: the Status as JSON.
+type Checker struct {
+	// Client is used to poll the tunnel state.
+	Client *rest.Client
+	// TunnelID is the ID of the checked tunnel.
+	TunnelID string
+	// Interval between refreshes. Defaults to 10s.
+	Interval time.Duration
+	// MaxAge is the age after which the cached state is considered stale,
+	// and the tunnel not ready. Defaults to 3 intervals.
+	MaxAge time.Duration
+	// ClientStatusMaxAge, if set, makes the tunnel not ready if the last
+	// successful UpdateClientStatus is older.
+	ClientStatusMaxAge time.Duration
+
+	mu     sync.RWMutex
+	status Status
+}
+
+// Run refreshes the state every Interval until `ctx` is done.
+func (c *Checker) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval())
+	defer ticker.Stop()
+
+	for {
+		_ = c.Refresh(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh retrieves the tunnel state, and updates the cache.
+func (c *Checker) Refresh(ctx context.Context) error {
+	state, err := c.Client.TunnelState(ctx, c.TunnelID)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.status.TunnelID = c.TunnelID
+	c.status.APIReachable = err == nil
+
+	if err != nil {
+		c.status.LastError = err.Error()
+
+		return err
+	}
+
+	c.status.LastError = ""
+	now := time.Now()
+	c.status.LastRefresh = &now
+	c.status.TunnelStatus = state.Status
+	c.status.IsReady = state.IsReady
+	c.status.ShutdownReason = state.ShutdownReason
+
+	// The shutdown time is set before the status changes.
+	if state.ShutdownTime != 0 && c.status.TunnelStatus != rest.TunnelStatusTerminated {
+		c.status.TunnelStatus = rest.TunnelStatusTerminated
+	}
+
+	return nil
+}
+
+// UpdateClientStatus updates the client status with Client, and records the
+// time of successful updates.
+func (c *Checker) UpdateClientStatus(
+	ctx context.Context, connected bool, duration time.Duration, memory *rest.Memory,
+) (rest.UpdateClientStatusResponse, error) {
+	resp, err := c.Client.UpdateClientStatus(ctx, c.TunnelID, connected, duration, memory)
+	if err == nil {
+		c.mu.Lock()
+		now := time.Now()
+		c.status.LastClientStatus = &now
+		c.mu.Unlock()
+	}
+
+	return resp, err
+}
+
+// Status returns the cached status.
+func (c *Checker) Status() Status {
+	c.mu.RLock()
+	s := c.status
+	c.mu.RUnlock()
+
+	s.TunnelID = c.TunnelID
+	s.Live = s.TunnelStatus != rest.TunnelStatusTerminated
+
+	now := time.Now()
+
+	switch {
+	case s.LastRefresh == nil:
+		s.Reasons = append(s.Reasons, "tunnel state unknown")
+	case now.Sub(*s.LastRefresh) > c.maxAge():
+		s.Reasons = append(s.Reasons, "tunnel state is stale")
+	}
+
+	if !s.Live {
+		s.Reasons = append(s.Reasons, "tunnel is shut down")
+	} else if s.LastRefresh != nil && !s.IsReady {
+		s.Reasons = append(s.Reasons, "tunnel is not ready")
+	}
+
+	if c.ClientStatusMaxAge > 0 && (s.LastClientStatus == nil || now.Sub(*s.LastClientStatus) > c.ClientStatusMaxAge) {
+		s.Reasons = append(s.Reasons, "client status is stale")
+	}
+
+	s.Ready = len(s.Reasons) == 0
+
+	return s
+}
+
+// ServeHTTP interface implementation.
+func (c *Checker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+
+	s := c.Status()
+
+	switch r.URL.Path {
+	case "/healthz":
+		writeProbe(w, s.Live)
+	case "/readyz":
+		writeProbe(w, s.Ready)
+	case "/status":
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(s)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func writeProbe(w http.ResponseWriter, ok bool) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	if !ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte("not ok\n"))
+
+		return
+	}
+
+	_, _ = w.Write([]byte("ok\n"))
+}
+
+func (c *Checker) interval() time.Duration {
+	if c.Interval <= 0 {
+		return defaultInterval
+	}
+
+	return c.Interval
+}
+
+func (c *Checker) maxAge() time.Duration {
+	if c.MaxAge <= 0 {
+		return 3 * c.interval()
+	}
+
+	return c.MaxAge
+}
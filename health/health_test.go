@@ -0,0 +1,156 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	rest "github.com/saucelabs/tunnelrest-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeAPI serves the state of tunnel "t1", or fails if state is nil.
+type fakeAPI struct {
+	mu    sync.Mutex
+	state *rest.TunnelState
+	calls int
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls++
+
+	if r.Method == http.MethodPost {
+		_, _ = w.Write([]byte(`{"id": "t1", "result": true}`))
+
+		return
+	}
+
+	if f.state == nil {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(f.state)
+}
+
+func (f *fakeAPI) set(state *rest.TunnelState) {
+	f.mu.Lock()
+	f.state = state
+	f.mu.Unlock()
+}
+
+func probe(t *testing.T, h http.Handler, path string) int {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+	return rec.Code
+}
+
+func TestChecker(t *testing.T) {
+	api := &fakeAPI{state: &rest.TunnelState{ID: "t1", Status: "new"}}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	c := &Checker{Client: &rest.Client{BaseURL: server.URL, User: "bob"}, TunnelID: "t1"}
+
+	// Nothing is known yet.
+	assert.Equal(t, http.StatusOK, probe(t, c, "/healthz"))
+	assert.Equal(t, http.StatusServiceUnavailable, probe(t, c, "/readyz"))
+
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	assert.NotContains(t, rec.Body.String(), "last_refresh")
+	assert.NotContains(t, rec.Body.String(), "last_client_status")
+
+	assert.NoError(t, c.Refresh(context.Background()))
+	assert.Equal(t, http.StatusServiceUnavailable, probe(t, c, "/readyz"))
+	assert.Equal(t, []string{"tunnel is not ready"}, c.Status().Reasons)
+
+	api.set(&rest.TunnelState{ID: "t1", Status: "running", IsReady: true})
+	assert.NoError(t, c.Refresh(context.Background()))
+	assert.Equal(t, http.StatusOK, probe(t, c, "/readyz"))
+
+	// Probes are served from the cache.
+	calls := api.calls
+	for i := 0; i < 10; i++ {
+		probe(t, c, "/readyz")
+	}
+	assert.Equal(t, calls, api.calls)
+
+	// The API is unreachable, the cached state is still fresh.
+	api.set(nil)
+	assert.Error(t, c.Refresh(context.Background()))
+	assert.Equal(t, http.StatusOK, probe(t, c, "/readyz"))
+	assert.False(t, c.Status().APIReachable)
+
+	api.set(&rest.TunnelState{ID: "t1", Status: "running", IsReady: true, ShutdownTime: 1, ShutdownReason: "sigterm"})
+	assert.NoError(t, c.Refresh(context.Background()))
+	assert.Equal(t, http.StatusServiceUnavailable, probe(t, c, "/healthz"))
+	assert.Equal(t, http.StatusServiceUnavailable, probe(t, c, "/readyz"))
+
+	rec = httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+
+	var s Status
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &s))
+	assert.Equal(t, rest.TunnelStatusTerminated, s.TunnelStatus)
+	assert.NotNil(t, s.LastRefresh)
+	assert.Equal(t, "sigterm", s.ShutdownReason)
+	assert.False(t, s.Live)
+
+	assert.Equal(t, http.StatusNotFound, probe(t, c, "/other"))
+}
+
+func TestCheckerStale(t *testing.T) {
+	api := &fakeAPI{state: &rest.TunnelState{ID: "t1", IsReady: true}}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	c := &Checker{
+		Client:             &rest.Client{BaseURL: server.URL, User: "bob"},
+		TunnelID:           "t1",
+		MaxAge:             20 * time.Millisecond,
+		ClientStatusMaxAge: time.Minute,
+	}
+
+	assert.NoError(t, c.Refresh(context.Background()))
+	assert.Equal(t, []string{"client status is stale"}, c.Status().Reasons)
+
+	_, err := c.UpdateClientStatus(context.Background(), true, time.Second, nil)
+	assert.NoError(t, err)
+	assert.True(t, c.Status().Ready)
+
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, []string{"tunnel state is stale"}, c.Status().Reasons)
+}
+
+func TestCheckerRun(t *testing.T) {
+	api := &fakeAPI{state: &rest.TunnelState{ID: "t1", IsReady: true}}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	c := &Checker{Client: &rest.Client{BaseURL: server.URL, User: "bob"}, TunnelID: "t1", Interval: time.Millisecond}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		c.Run(ctx)
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool { return c.Status().Ready }, time.Second, time.Millisecond)
+
+	cancel()
+	<-done
+}
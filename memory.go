@@ -0,0 +1,201 @@
+package rest
+
+import (
+	"bufio"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// cgroupV1Unlimited is the smallest cgroup v1 limit treated as unlimited,
+// the kernel reports the max page-aligned int64 when no limit is set.
+const cgroupV1Unlimited = math.MaxInt64 &^ 0xfff
+
+var errNoCgroupLimit = errors.New("no cgroup memory limit")
+
+// CollectMemory returns the memory info of the client host. In a container
+// with a cgroup (v1 or v2) memory limit the container limit and usage are
+// reported, otherwise the host memory is read from /proc/meminfo.
+func CollectMemory() (*Memory, error) {
+	return collectMemory("/")
+}
+
+func collectMemory(root string) (*Memory, error) {
+	host, err := readMeminfo(filepath.Join(root, "proc", "meminfo"))
+	if err != nil {
+		return nil, err
+	}
+
+	cgroup := filepath.Join(root, "sys", "fs", "cgroup")
+	v1, v2 := readProcCgroup(filepath.Join(root, "proc", "self", "cgroup"))
+
+	m, err := cgroupV2Memory(cgroupDir(cgroup, v2))
+	if err != nil {
+		m, err = cgroupV1Memory(cgroupDir(filepath.Join(cgroup, "memory"), v1))
+	}
+
+	if err == nil && m.Total < host["MemTotal"] {
+		return m, nil
+	}
+
+	return &Memory{
+		Total:     host["MemTotal"],
+		Available: host["MemAvailable"],
+		Used:      subtract(host["MemTotal"], host["MemAvailable"]),
+		Free:      host["MemFree"],
+	}, nil
+}
+
+// readProcCgroup returns the cgroup v1 memory controller and the cgroup v2
+// paths of the process, e.g. "/kubepods/pod1" for "0::/kubepods/pod1".
+// Paths not found are empty.
+func readProcCgroup(path string) (v1, v2 string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", ""
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		// hierarchy-ID:controller-list:cgroup-path
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+
+		if parts[0] == "0" && parts[1] == "" {
+			v2 = parts[2]
+
+			continue
+		}
+
+		for _, controller := range strings.Split(parts[1], ",") {
+			if controller == "memory" {
+				v1 = parts[2]
+			}
+		}
+	}
+
+	return v1, v2
+}
+
+// cgroupDir returns the directory of cgroup `path` under the hierarchy mount
+// point `mount`. Without a cgroup namespace the path may not be visible, then
+// the mount point itself is used.
+func cgroupDir(mount, path string) string {
+	if path == "" || path == "/" {
+		return mount
+	}
+
+	dir := filepath.Join(mount, filepath.FromSlash(path))
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return mount
+	}
+
+	return dir
+}
+
+func cgroupV2Memory(dir string) (*Memory, error) {
+	limit, err := readCgroupValue(filepath.Join(dir, "memory.max"))
+	if err != nil {
+		return nil, err
+	}
+
+	usage, err := readCgroupValue(filepath.Join(dir, "memory.current"))
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := readCgroupStat(filepath.Join(dir, "memory.stat"))
+	if err != nil {
+		return nil, err
+	}
+
+	return cgroupMemory(limit, usage, stat["inactive_file"]), nil
+}
+
+func cgroupV1Memory(dir string) (*Memory, error) {
+	limit, err := readCgroupValue(filepath.Join(dir, "memory.limit_in_bytes"))
+	if err != nil {
+		return nil, err
+	}
+
+	if limit >= cgroupV1Unlimited {
+		return nil, errNoCgroupLimit
+	}
+
+	usage, err := readCgroupValue(filepath.Join(dir, "memory.usage_in_bytes"))
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := readCgroupStat(filepath.Join(dir, "memory.stat"))
+	if err != nil {
+		return nil, err
+	}
+
+	return cgroupMemory(limit, usage, stat["total_inactive_file"]), nil
+}
+
+// cgroupMemory computes the memory info the same way as the kubelet does,
+// used memory is the working set i.e. usage without the inactive page cache.
+func cgroupMemory(limit, usage, inactiveFile uint64) *Memory {
+	used := subtract(usage, inactiveFile)
+
+	return &Memory{
+		Total:     limit,
+		Available: subtract(limit, used),
+		Used:      used,
+		Free:      subtract(limit, usage),
+	}
+}
+
+// readCgroupValue reads a single value cgroup file, "max" means no limit.
+func readCgroupValue(path string) (uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	value := strings.TrimSpace(string(data))
+	if value == "max" {
+		return 0, errNoCgroupLimit
+	}
+
+	return strconv.ParseUint(value, 10, 64)
+}
+
+// readCgroupStat reads a "key value" per line cgroup file.
+func readCgroupStat(path string) (map[string]uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	stat := make(map[string]uint64)
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+
+		if n, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			stat[fields[0]] = n
+		}
+	}
+
+	return stat, scanner.Err()
+}
+
+func subtract(a, b uint64) uint64 {
+	if b > a {
+		return 0
+	}
+
+	return a - b
+}
@@ -0,0 +1,68 @@
+package rest
+
+import (
+	"path/filepath"
+	"testing"
+
+	assertLib "github.com/stretchr/testify/assert"
+)
+
+func TestCollectMemory(t *testing.T) {
+	const (
+		KiB = 1024
+		MiB = 1024 * KiB
+		GiB = 1024 * MiB
+	)
+
+	host := Memory{Total: 8 * GiB, Available: 4 * GiB, Used: 4 * GiB, Free: 2 * GiB}
+
+	tests := []struct {
+		name string
+		root string
+		want Memory
+	}{
+		{
+			name: "cgroup v2 with limit",
+			root: "v2",
+			want: Memory{Total: 1 * GiB, Available: 640 * MiB, Used: 384 * MiB, Free: 512 * MiB},
+		},
+		{
+			name: "cgroup v1 with limit",
+			root: "v1",
+			want: Memory{Total: 2 * GiB, Available: 1280 * MiB, Used: 768 * MiB, Free: 1 * GiB},
+		},
+		{
+			name: "nested cgroup v2 with limit",
+			root: "v2-nested",
+			want: Memory{Total: 1 * GiB, Available: 640 * MiB, Used: 384 * MiB, Free: 512 * MiB},
+		},
+		{
+			name: "nested cgroup v1 with limit",
+			root: "v1-nested",
+			want: Memory{Total: 2 * GiB, Available: 1280 * MiB, Used: 768 * MiB, Free: 1 * GiB},
+		},
+		{
+			name: "cgroup v2 without limit",
+			root: "v2-unlimited",
+			want: host,
+		},
+		{
+			name: "no cgroup",
+			root: "host",
+			want: host,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := collectMemory(filepath.Join("testdata", "memory", tt.root))
+			assertLib.NoError(t, err)
+			assertLib.Equal(t, tt.want, *got)
+		})
+	}
+}
+
+func TestCollectMemoryMissingMeminfo(t *testing.T) {
+	_, err := collectMemory(filepath.Join("testdata", "memory", "missing"))
+	assertLib.Error(t, err)
+}
@@ -0,0 +1,161 @@
+package rest
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Severity is the severity level of a server message.
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityFatal
+)
+
+// String interface implementation.
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityFatal:
+		return "fatal"
+	default:
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+}
+
+// MessageSource is the endpoint a message was returned by.
+type MessageSource string
+
+const (
+	// MessageSourceCreate are messages returned by tunnel creation.
+	MessageSourceCreate MessageSource = "create"
+	// MessageSourceUpdates are messages returned by GetSCUpdates.
+	MessageSourceUpdates MessageSource = "updates"
+)
+
+// Message is a server message.
+type Message struct {
+	Severity Severity
+	Text     string
+	Source   MessageSource
+}
+
+// String interface implementation.
+func (m Message) String() string {
+	return fmt.Sprintf("%s (%s): %s", m.Severity, m.Source, m.Text)
+}
+
+// MessageHandler handles server messages.
+type MessageHandler interface {
+	HandleMessage(Message)
+}
+
+// MessageHandlerFunc is a function MessageHandler.
+type MessageHandlerFunc func(Message)
+
+// HandleMessage interface implementation.
+func (f MessageHandlerFunc) HandleMessage(m Message) { f(m) }
+
+// DedupHandler forwards each message to Handler once, messages are identified
+// by their severity and text. It's safe for concurrent use.
+type DedupHandler struct {
+	Handler MessageHandler
+
+	mu   sync.Mutex
+	seen map[dedupKey]bool
+}
+
+type dedupKey struct {
+	severity Severity
+	text     string
+}
+
+// NewDedupHandler returns a DedupHandler forwarding to `h`.
+func NewDedupHandler(h MessageHandler) *DedupHandler {
+	return &DedupHandler{Handler: h}
+}
+
+// HandleMessage interface implementation.
+func (d *DedupHandler) HandleMessage(m Message) {
+	key := dedupKey{severity: m.Severity, text: m.Text}
+
+	d.mu.Lock()
+	if d.seen == nil {
+		d.seen = make(map[dedupKey]bool)
+	}
+
+	seen := d.seen[key]
+	d.seen[key] = true
+	d.mu.Unlock()
+
+	if !seen {
+		d.Handler.HandleMessage(m)
+	}
+}
+
+// Reset forgets the messages seen so far.
+func (d *DedupHandler) Reset() {
+	d.mu.Lock()
+	d.seen = nil
+	d.mu.Unlock()
+}
+
+// Messages returns the messages ordered by decreasing severity.
+func (m SCMessages) Messages(source MessageSource) []Message {
+	var msgs []Message
+
+	for _, group := range []struct {
+		severity Severity
+		texts    []string
+	}{
+		{SeverityFatal, m.Fatal},
+		{SeverityWarning, m.Warning},
+		{SeverityInfo, m.Info},
+	} {
+		for _, text := range group.texts {
+			msgs = append(msgs, Message{Severity: group.severity, Text: text, Source: source})
+		}
+	}
+
+	return msgs
+}
+
+// FatalMessageError is returned when the server responds with fatal messages,
+// and Client.FatalAsError is set.
+type FatalMessageError struct {
+	Messages []Message
+}
+
+// Error interface implementation.
+func (e *FatalMessageError) Error() string {
+	texts := make([]string, len(e.Messages))
+	for i, m := range e.Messages {
+		texts[i] = m.Text
+	}
+
+	return fmt.Sprintf("fatal server message: %s", strings.Join(texts, "; "))
+}
+
+// handleMessages passes `m` to the client MessageHandler, and returns a
+// *FatalMessageError for fatal messages if FatalAsError is set.
+func (c *Client) handleMessages(source MessageSource, m SCMessages) error {
+	msgs := m.Messages(source)
+
+	if c.MessageHandler != nil {
+		for _, msg := range msgs {
+			c.MessageHandler.HandleMessage(msg)
+		}
+	}
+
+	if !c.FatalAsError || len(m.Fatal) == 0 {
+		return nil
+	}
+
+	return &FatalMessageError{Messages: msgs[:len(m.Fatal)]}
+}
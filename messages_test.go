@@ -0,0 +1,86 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/saucelabs/tunnelrest-go/region"
+	assertLib "github.com/stretchr/testify/assert"
+)
+
+func TestClientMessageHandler(t *testing.T) {
+	assert := assertLib.New(t)
+
+	createJSON := `{"id": "1", "messages": {"info": ["maintenance at 5pm"], "warning": ["old version"]}}`
+	updatesJSON := `{"info": ["maintenance at 5pm"], "fatal": ["version is blocked"], "configuration": {"regions": [{"name": "us-west-1"}]}}`
+
+	server := multiResponseServer([]resp{
+		{path: fmt.Sprintf("/%s/tunnels", tunnelUser), handler: stringResponse(createJSON), method: http.MethodPost},
+		{path: fmt.Sprintf("/%s/tunnels/info/updates", tunnelUser), handler: stringResponse(updatesJSON), method: http.MethodGet},
+	})
+	defer server.Close()
+
+	var got []Message
+
+	client := &Client{
+		BaseURL: server.URL,
+		User:    tunnelUser,
+		MessageHandler: NewDedupHandler(MessageHandlerFunc(func(m Message) {
+			got = append(got, m)
+		})),
+	}
+
+	_, err := client.CreateTunnelV5(context.Background(), &CreateTunnelRequestV5{}, time.Second)
+	assert.NoError(err)
+
+	_, err = client.GetSCUpdates(context.Background(), "linux", "5.0.0", "", "us-west-1", "", false)
+	assert.NoError(err)
+
+	assert.Equal([]Message{
+		{Severity: SeverityWarning, Text: "old version", Source: MessageSourceCreate},
+		{Severity: SeverityInfo, Text: "maintenance at 5pm", Source: MessageSourceCreate},
+		{Severity: SeverityFatal, Text: "version is blocked", Source: MessageSourceUpdates},
+	}, got)
+}
+
+func TestClientFatalAsError(t *testing.T) {
+	assert := assertLib.New(t)
+
+	updatesJSON := `{"fatal": ["version is blocked", "upgrade now"], "configuration": {"regions": [{"name": "us-west-1"}]}}`
+
+	server := multiResponseServer([]resp{
+		{path: fmt.Sprintf("/%s/tunnels/info/updates", tunnelUser), handler: stringResponse(updatesJSON), method: http.MethodGet},
+	})
+	defer server.Close()
+
+	client := &Client{BaseURL: server.URL, User: tunnelUser, FatalAsError: true}
+
+	updates, err := client.GetSCUpdates(context.Background(), "linux", "5.0.0", "", "us-west-1", "", false)
+	assert.EqualError(err, "fatal server message: version is blocked; upgrade now")
+	assert.Equal([]region.Region{{Name: "us-west-1"}}, updates.Configuration.Regions)
+
+	var fatalErr *FatalMessageError
+	assert.True(errors.As(err, &fatalErr))
+	assert.Len(fatalErr.Messages, 2)
+}
+
+func TestDedupHandlerReset(t *testing.T) {
+	assert := assertLib.New(t)
+
+	count := 0
+	h := NewDedupHandler(MessageHandlerFunc(func(Message) { count++ }))
+
+	m := Message{Severity: SeverityInfo, Text: "hello"}
+	h.HandleMessage(m)
+	h.HandleMessage(m)
+	h.HandleMessage(Message{Severity: SeverityWarning, Text: "hello"})
+	assert.Equal(2, count)
+
+	h.Reset()
+	h.HandleMessage(m)
+	assert.Equal(3, count)
+}
@@ -0,0 +1,207 @@
+package rest
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	"github.com/saucelabs/tunnelrest-go/util"
+)
+
+// procRoot is the procfs mount point, overridden in tests.
+var procRoot = "/proc"
+
+// CollectMetadata gathers the client host metadata. Non-zero fields of
+// `overrides` take precedence over the collected values.
+//
+// On Linux the kernel, CPU and memory information is read from procfs, on
+// other platforms only the portable fields are filled.
+func CollectMetadata(overrides Metadata) Metadata {
+	m := collectMetadata(procRoot)
+
+	return m.merge(overrides)
+}
+
+func collectMetadata(root string) Metadata {
+	m := Metadata{
+		Platform:    fmt.Sprintf("%s-%s", runtime.GOOS, runtime.GOARCH),
+		NoFileLimit: noFileLimit(),
+	}
+
+	m.Hostname, _ = os.Hostname()
+
+	// Secrets in the command line are redacted.
+	if len(os.Args) > 0 {
+		m.Command = os.Args[0]
+		m.CommandArgs = strings.Join(util.DefaultRedactor.RedactArgs(os.Args[1:]), " ")
+	}
+
+	// Same as `uname -r`.
+	if release, err := os.ReadFile(filepath.Join(root, "sys", "kernel", "osrelease")); err == nil {
+		m.Release = strings.TrimSpace(string(release))
+	}
+
+	m.HostCPU = hostCPU(filepath.Join(root, "cpuinfo"))
+
+	if info, err := readMeminfo(filepath.Join(root, "meminfo")); err == nil {
+		m.HostMemory = info["MemTotal"]
+	}
+
+	m.GitVersion, m.Build = buildVersion()
+
+	return m
+}
+
+// merge returns `m` with the non-zero fields of `o` applied on top.
+func (m Metadata) merge(o Metadata) Metadata {
+	setString := func(dst *string, src string) {
+		if src != "" {
+			*dst = src
+		}
+	}
+
+	setString(&m.Build, o.Build)
+	setString(&m.Command, o.Command)
+	setString(&m.CommandArgs, o.CommandArgs)
+	setString(&m.ExternalProxy, o.ExternalProxy)
+	setString(&m.GitVersion, o.GitVersion)
+	setString(&m.Hostname, o.Hostname)
+	setString(&m.HostCPU, o.HostCPU)
+	setString(&m.Platform, o.Platform)
+	setString(&m.Release, o.Release)
+
+	if o.HostMemory != 0 {
+		m.HostMemory = o.HostMemory
+	}
+
+	if o.NoFileLimit != 0 {
+		m.NoFileLimit = o.NoFileLimit
+	}
+
+	if len(o.Extra) > 0 {
+		extra := make(map[string]string, len(m.Extra)+len(o.Extra))
+		for k, v := range m.Extra {
+			extra[k] = v
+		}
+
+		for k, v := range o.Extra {
+			extra[k] = v
+		}
+
+		m.Extra = extra
+	}
+
+	return m
+}
+
+// hostCPU returns the CPU model and the number of logical CPUs, e.g.
+// "8 x Intel(R) Xeon(R) Processor".
+func hostCPU(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Sprintf("%d x %s", runtime.NumCPU(), runtime.GOARCH)
+	}
+	defer f.Close()
+
+	var (
+		model string
+		count int
+	)
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+
+		switch strings.TrimSpace(key) {
+		case "processor":
+			count++
+		case "model name", "Model", "Hardware":
+			if model == "" {
+				model = strings.TrimSpace(value)
+			}
+		}
+	}
+
+	if count == 0 {
+		count = runtime.NumCPU()
+	}
+
+	if model == "" {
+		model = runtime.GOARCH
+	}
+
+	return fmt.Sprintf("%d x %s", count, model)
+}
+
+// readMeminfo parses a /proc/meminfo file, values are in bytes.
+func readMeminfo(path string) (map[string]uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info := make(map[string]uint64)
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+
+		n, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		if len(fields) > 1 && fields[1] == "kB" {
+			n *= 1024
+		}
+
+		info[key] = n
+	}
+
+	return info, scanner.Err()
+}
+
+// buildVersion returns the VCS revision and the module version of the
+// running binary.
+func buildVersion() (gitVersion, build string) {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "", ""
+	}
+
+	build = info.Main.Version
+
+	var modified bool
+
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			gitVersion = s.Value
+		case "vcs.modified":
+			modified = s.Value == "true"
+		}
+	}
+
+	if gitVersion != "" && modified {
+		gitVersion += "-dirty"
+	}
+
+	return gitVersion, build
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package rest
+
+// noFileLimit is not available on this platform.
+func noFileLimit() uint64 {
+	return 0
+}
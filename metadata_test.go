@@ -0,0 +1,25 @@
+package rest
+
+import (
+	"path/filepath"
+	"testing"
+
+	assertLib "github.com/stretchr/testify/assert"
+)
+
+func TestCollectMetadata(t *testing.T) {
+	assert := assertLib.New(t)
+
+	m := collectMetadata(filepath.Join("testdata", "proc"))
+
+	assert.Equal("6.1.0-18-amd64", m.Release)
+	assert.Equal("2 x Intel(R) Xeon(R) Processor", m.HostCPU)
+	assert.Equal(uint64(6147400*1024), m.HostMemory)
+	assert.NotEmpty(m.Platform)
+	assert.NotEmpty(m.Command)
+
+	m = m.merge(Metadata{Hostname: "override", Extra: map[string]string{"k": "v"}})
+	assert.Equal("override", m.Hostname)
+	assert.Equal("6.1.0-18-amd64", m.Release)
+	assert.Equal(map[string]string{"k": "v"}, m.Extra)
+}
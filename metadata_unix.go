@@ -0,0 +1,15 @@
+//go:build unix
+
+package rest
+
+import "syscall"
+
+// noFileLimit returns the soft limit of open file descriptors.
+func noFileLimit() uint64 {
+	var rlim syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlim); err != nil {
+		return 0
+	}
+
+	return uint64(rlim.Cur)
+}
@@ -0,0 +1,130 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/saucelabs/tunnelrest-go/util"
+)
+
+// OperationName identifies the REST API endpoint of an Operation.
+type OperationName string
+
+// Operation names. The Operation Response of each operation is noted, it's
+// nil if not mentioned.
+const (
+	// OperationCreateTunnel responds with a *TunnelStateWithMessages.
+	OperationCreateTunnel OperationName = "create_tunnel"
+	// OperationShutdownTunnel responds with a *ShutdownTunnelResponse.
+	OperationShutdownTunnel OperationName = "shutdown_tunnel"
+	// OperationTunnelState responds with a *TunnelState.
+	OperationTunnelState OperationName = "tunnel_state"
+	// OperationListTunnels responds with a *[]TunnelState.
+	OperationListTunnels OperationName = "list_tunnels"
+	// OperationListSharedTunnels responds with a *map[string][]TunnelState,
+	// keyed by owner.
+	OperationListSharedTunnels OperationName = "list_shared_tunnels"
+	// OperationListAllTunnels responds with a *map[string][]TunnelState,
+	// with a "tunnels" key.
+	OperationListAllTunnels OperationName = "list_all_tunnels"
+	// OperationWalkTunnels, OperationWalkSharedTunnels and
+	// OperationWalkAllTunnels are the List operations of the Walk methods.
+	// The tunnel states are streamed to the Walk callback, and their Response
+	// is opaque. A middleware short-circuiting them passes the states to
+	// Operation.Yield.
+	OperationWalkTunnels       OperationName = "walk_tunnels"
+	OperationWalkSharedTunnels OperationName = "walk_shared_tunnels"
+	OperationWalkAllTunnels    OperationName = "walk_all_tunnels"
+	// OperationGetSCUpdates responds with a *SCUpdates.
+	OperationGetSCUpdates OperationName = "get_sc_updates"
+	// OperationGetVersions responds with a *SCVersions.
+	OperationGetVersions OperationName = "get_versions"
+	// OperationUpdateClientStatus responds with a
+	// *UpdateClientStatusResponse.
+	OperationUpdateClientStatus OperationName = "update_client_status"
+	// OperationReportCrash has no Response.
+	OperationReportCrash OperationName = "report_crash"
+)
+
+// ErrNotWalk is returned by Operation.Yield for operations other than the
+// Walk ones.
+var ErrNotWalk = errors.New("operation is not a walk")
+
+// Operation describes a REST API call going through the Client Middleware.
+type Operation struct {
+	Name OperationName
+	// TunnelID is the ID of the tunnel the operation is about, if any.
+	TunnelID string
+
+	Method string
+	URL    string
+	// Header is set on the HTTP request, after the client headers and
+	// authentication, e.g. to replace them.
+	Header http.Header
+
+	// Request is the value encoded as the request body, if any.
+	Request interface{}
+	// Response is a pointer to the value the response body is decoded to, if
+	// any. A middleware short-circuiting the call fills it.
+	Response interface{}
+
+	// StatusCode is the HTTP status code of the response, once the request
+	// was sent.
+	StatusCode int
+
+	// redactHeaders is the header redaction of the client.
+	redactHeaders func(http.Header) http.Header
+}
+
+// Yield passes `state` to the callback of a Walk operation, e.g. from a
+// middleware short-circuiting it with cached states. `key` is the owner of
+// the tunnel for OperationWalkSharedTunnels, and ignored otherwise. The error
+// of the callback, if any, stops the walk and must be returned by the
+// middleware.
+func (op *Operation) Yield(key string, state TunnelState) error {
+	s, ok := op.Response.(*tunnelStream)
+	if !ok {
+		return ErrNotWalk
+	}
+
+	if err := s.fn(key, state); err != nil {
+		s.err = err
+
+		return err
+	}
+
+	return nil
+}
+
+// RedactedHeader returns a copy of Header with the secrets masked, as the
+// client redacts them, e.g. to be logged.
+func (op *Operation) RedactedHeader() http.Header {
+	if op.redactHeaders == nil {
+		return util.DefaultRedactor.RedactHeaders(op.Header)
+	}
+
+	return op.redactHeaders(op.Header)
+}
+
+// Invoker performs an Operation. Errors are `*ClientError`, unless returned
+// by a middleware.
+type Invoker func(ctx context.Context, op *Operation) error
+
+// Middleware wraps an Invoker. It may modify the operation, observe it, call
+// `next` several times, e.g. to retry, or not at all, to short-circuit the
+// call.
+type Middleware func(next Invoker) Invoker
+
+// invoke performs `op` through the client Middleware.
+func (c *Client) invoke(ctx context.Context, op *Operation) error {
+	next := Invoker(c.send)
+
+	for i := len(c.Middleware) - 1; i >= 0; i-- {
+		next = c.Middleware[i](next)
+	}
+
+	op.redactHeaders = c.redactHeaders
+
+	return next(ctx, op)
+}
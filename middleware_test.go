@@ -0,0 +1,217 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/saucelabs/tunnelrest-go/util"
+	assertLib "github.com/stretchr/testify/assert"
+)
+
+func TestMiddlewareOrder(t *testing.T) {
+	assert := assertLib.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": "abc", "status": "running"}`)
+	}))
+	defer server.Close()
+
+	var trace []string
+
+	layer := func(name string) Middleware {
+		return func(next Invoker) Invoker {
+			return func(ctx context.Context, op *Operation) error {
+				trace = append(trace, fmt.Sprintf("%s>%s:%s", name, op.Name, op.TunnelID))
+				err := next(ctx, op)
+				trace = append(trace, fmt.Sprintf("%s<%d", name, op.StatusCode))
+
+				return err
+			}
+		}
+	}
+
+	c := &Client{
+		BaseURL:    server.URL,
+		User:       "user",
+		Middleware: []Middleware{layer("a"), layer("b")},
+	}
+
+	state, err := c.TunnelState(context.Background(), "abc")
+	assert.NoError(err)
+	assert.Equal("abc", state.ID)
+	assert.Equal([]string{
+		"a>tunnel_state:abc",
+		"b>tunnel_state:abc",
+		"b<200",
+		"a<200",
+	}, trace)
+}
+
+func TestMiddlewareShortCircuit(t *testing.T) {
+	assert := assertLib.New(t)
+
+	c := &Client{
+		BaseURL: "http://127.0.0.1:0",
+		Middleware: []Middleware{func(next Invoker) Invoker {
+			return func(ctx context.Context, op *Operation) error {
+				if op.Name == OperationListTunnels {
+					*op.Response.(*[]TunnelState) = []TunnelState{{ID: "cached"}}
+
+					return nil
+				}
+
+				return next(ctx, op)
+			}
+		}},
+	}
+
+	ids, err := c.ListTunnels()
+	assert.NoError(err)
+	assert.Equal([]string{"cached"}, ids)
+
+	_, err = c.TunnelState(context.Background(), "abc")
+
+	var cE *ClientError
+	assert.True(errors.As(err, &cE), "expected the request to be sent, got %v", err)
+}
+
+func TestMiddlewareRetryAndHeaders(t *testing.T) {
+	assert := assertLib.New(t)
+
+	var calls int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+
+			return
+		}
+
+		fmt.Fprint(w, `{"jobs_running": 2}`)
+	}))
+	defer server.Close()
+
+	auth := func(next Invoker) Invoker {
+		return func(ctx context.Context, op *Operation) error {
+			op.Header = http.Header{"Authorization": {"Bearer token"}}
+
+			return next(ctx, op)
+		}
+	}
+
+	retry := func(next Invoker) Invoker {
+		return func(ctx context.Context, op *Operation) error {
+			err := next(ctx, op)
+
+			var cE *ClientError
+			if errors.As(err, &cE) && cE.StatusCode == http.StatusServiceUnavailable {
+				err = next(ctx, op)
+			}
+
+			return err
+		}
+	}
+
+	c := &Client{
+		BaseURL:    server.URL,
+		User:       "user",
+		APIKey:     "key",
+		Middleware: []Middleware{retry, auth},
+	}
+
+	jobs, err := c.ShutdownTunnel(context.Background(), "abc", "sigterm", false)
+	assert.NoError(err)
+	assert.Equal(2, jobs)
+	assert.EqualValues(2, atomic.LoadInt32(&calls))
+}
+
+func TestMiddlewareShortCircuitWalk(t *testing.T) {
+	assert := assertLib.New(t)
+
+	cached := []TunnelState{{ID: "1"}, {ID: "2"}, {ID: "3"}}
+
+	c := &Client{
+		BaseURL: "http://127.0.0.1:0",
+		Middleware: []Middleware{func(next Invoker) Invoker {
+			return func(ctx context.Context, op *Operation) error {
+				switch op.Name {
+				case OperationListTunnels:
+					*op.Response.(*[]TunnelState) = cached
+				case OperationWalkTunnels:
+					for _, s := range cached {
+						if err := op.Yield("", s); err != nil {
+							return err
+						}
+					}
+				default:
+					return next(ctx, op)
+				}
+
+				return nil
+			}
+		}},
+	}
+
+	ids, err := c.ListTunnels()
+	assert.NoError(err)
+	assert.Equal([]string{"1", "2", "3"}, ids)
+
+	stop := errors.New("stop")
+
+	var walked []string
+	err = c.WalkTunnelStates(context.Background(), func(s TunnelState) error {
+		walked = append(walked, s.ID)
+		if s.ID == "2" {
+			return stop
+		}
+
+		return nil
+	})
+	assert.ErrorIs(err, stop)
+	assert.Equal([]string{"1", "2"}, walked)
+
+	assert.ErrorIs((&Operation{Response: &cached}).Yield("", cached[0]), ErrNotWalk)
+}
+
+func TestOperationRedactedHeader(t *testing.T) {
+	assert := assertLib.New(t)
+
+	var got http.Header
+
+	client := Client{
+		BaseURL: "http://localhost",
+		APIKey:  "my-api-key",
+		Middleware: []Middleware{func(next Invoker) Invoker {
+			return func(ctx context.Context, op *Operation) error {
+				got = op.RedactedHeader()
+
+				return nil
+			}
+		}},
+	}
+
+	err := client.invoke(context.Background(), &Operation{
+		Method: http.MethodGet,
+		URL:    client.BaseURL,
+		Header: http.Header{
+			"Authorization": {"Bearer abc"},
+			"X-Trace":       {"key my-api-key"},
+		},
+	})
+	assert.NoError(err)
+	assert.Equal(http.Header{
+		"Authorization": {util.Mask},
+		"X-Trace":       {"key " + util.Mask},
+	}, got)
+}
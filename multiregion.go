@@ -0,0 +1,332 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/saucelabs/tunnelrest-go/region"
+)
+
+// RegionalTunnelState is a tunnel state annotated with its region. In JSON,
+// the region reported by the server, TunnelState.Region, is encoded as
+// "tunnel_region".
+type RegionalTunnelState struct {
+	TunnelState
+	Region region.Region `json:"region"`
+}
+
+// MultiRegionError contains the errors of the regions that failed, keyed by
+// region name.
+type MultiRegionError struct {
+	Errors map[string]error
+}
+
+// Error interface implementation.
+func (e *MultiRegionError) Error() string {
+	names := make([]string, 0, len(e.Errors))
+	for name := range e.Errors {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	msgs := make([]string, len(names))
+	for i, name := range names {
+		msgs[i] = fmt.Sprintf("%s: %v", name, e.Errors[name])
+	}
+
+	return fmt.Sprintf("%d region(s) failed: %s", len(names), strings.Join(msgs, "; "))
+}
+
+// MultiRegionClient queries several Sauce Labs regions at once. Listing calls
+// are sent to every region concurrently, and return the results of the
+// regions that succeeded along with a *MultiRegionError for the others.
+type MultiRegionClient struct {
+	regions []region.Region
+	clients map[string]*Client
+
+	mu            sync.Mutex
+	tunnelRegions map[string]string
+}
+
+// NewMultiRegionClient returns a client for `regions`. Every region gets a copy
+// of `template` with the region URL as BaseURL.
+func NewMultiRegionClient(template *Client, regions []region.Region) *MultiRegionClient {
+	m := &MultiRegionClient{
+		regions:       append([]region.Region{}, regions...),
+		clients:       make(map[string]*Client, len(regions)),
+		tunnelRegions: make(map[string]string),
+	}
+
+	for _, r := range regions {
+		c := *template
+		c.BaseURL = r.URL
+		m.clients[r.Name] = &c
+	}
+
+	return m
+}
+
+// Regions returns the configured regions.
+func (m *MultiRegionClient) Regions() []region.Region {
+	return append([]region.Region{}, m.regions...)
+}
+
+// Client returns the client of the region `name`.
+func (m *MultiRegionClient) Client(name string) (*Client, error) {
+	c, ok := m.clients[name]
+	if !ok {
+		return nil, m.invalidRegion(name)
+	}
+
+	return c, nil
+}
+
+// ListTunnelStates returns the tunnel states of every region.
+func (m *MultiRegionClient) ListTunnelStates(ctx context.Context, protocol ...Protocol) ([]RegionalTunnelState, error) {
+	var (
+		mu     sync.Mutex
+		states []RegionalTunnelState
+	)
+
+	err := m.fanOut(ctx, func(ctx context.Context, r region.Region, c *Client) error {
+		s, err := c.listTunnels(ctx, protocol...)
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		states = append(states, m.annotate(r, s)...)
+		mu.Unlock()
+
+		return nil
+	})
+
+	m.sortStates(states)
+
+	return states, err
+}
+
+// ListSharedTunnelStates returns the shared tunnel states per user of every
+// region.
+func (m *MultiRegionClient) ListSharedTunnelStates(
+	ctx context.Context, protocol ...Protocol,
+) (map[string][]RegionalTunnelState, error) {
+	var mu sync.Mutex
+
+	states := make(map[string][]RegionalTunnelState)
+
+	err := m.fanOut(ctx, func(ctx context.Context, r region.Region, c *Client) error {
+		s, err := c.listSharedTunnels(ctx, protocol...)
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		for user, userStates := range s {
+			states[user] = append(states[user], m.annotate(r, userStates)...)
+		}
+		mu.Unlock()
+
+		return nil
+	})
+
+	for _, userStates := range states {
+		m.sortStates(userStates)
+	}
+
+	return states, err
+}
+
+// ListAllTunnelStates returns the tunnel history of every region, up to
+// `limit` tunnels per region.
+func (m *MultiRegionClient) ListAllTunnelStates(ctx context.Context, limit int) ([]RegionalTunnelState, error) {
+	var (
+		mu     sync.Mutex
+		states []RegionalTunnelState
+	)
+
+	err := m.fanOut(ctx, func(ctx context.Context, r region.Region, c *Client) error {
+		s, err := c.listAllTunnelStates(ctx, limit)
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		states = append(states, m.annotate(r, s)...)
+		mu.Unlock()
+
+		return nil
+	})
+
+	m.sortStates(states)
+
+	return states, err
+}
+
+// TunnelState returns the state of the tunnel `id`. The tunnel is looked up
+// in every region, unless its region is already known.
+func (m *MultiRegionClient) TunnelState(ctx context.Context, id string) (RegionalTunnelState, error) {
+	if r, ok := m.tunnelRegion(id); ok {
+		state, err := m.clients[r.Name].TunnelState(ctx, id)
+
+		return RegionalTunnelState{TunnelState: state, Region: r}, err
+	}
+
+	var (
+		mu    sync.Mutex
+		found *RegionalTunnelState
+	)
+
+	err := m.fanOut(ctx, func(ctx context.Context, r region.Region, c *Client) error {
+		state, err := c.TunnelState(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		found = &RegionalTunnelState{TunnelState: state, Region: r}
+		mu.Unlock()
+
+		m.remember(id, r)
+
+		return nil
+	})
+
+	if found == nil {
+		return RegionalTunnelState{}, err
+	}
+
+	return *found, nil
+}
+
+// CreateTunnelV5 creates a Sauce Connect 5 tunnel in the region `name`.
+func (m *MultiRegionClient) CreateTunnelV5(
+	ctx context.Context, name string, req *CreateTunnelRequestV5, timeout time.Duration,
+) (TunnelStateWithMessages, error) {
+	c, err := m.Client(name)
+	if err != nil {
+		return TunnelStateWithMessages{}, err
+	}
+
+	// A FatalMessageError is returned along with the created tunnel, that
+	// is still remembered to be shut down.
+	tunnel, err := c.CreateTunnelV5(ctx, req, timeout)
+	if tunnel.ID != "" {
+		m.remember(tunnel.ID, m.region(name))
+	}
+
+	return tunnel, err
+}
+
+// ShutdownTunnel terminates the tunnel `id` in its region.
+func (m *MultiRegionClient) ShutdownTunnel(ctx context.Context, id string, reason string, wait bool) (int, error) {
+	state, err := m.TunnelState(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+
+	return m.clients[state.Region.Name].ShutdownTunnel(ctx, id, reason, wait)
+}
+
+// fanOut calls `fn` for every region concurrently. It returns a
+// *MultiRegionError if any of the calls failed.
+func (m *MultiRegionClient) fanOut(
+	ctx context.Context,
+	fn func(ctx context.Context, r region.Region, c *Client) error,
+) error {
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs = make(map[string]error)
+	)
+
+	for _, r := range m.regions {
+		wg.Add(1)
+
+		go func(r region.Region) {
+			defer wg.Done()
+
+			if err := fn(ctx, r, m.clients[r.Name]); err != nil {
+				mu.Lock()
+				errs[r.Name] = err
+				mu.Unlock()
+			}
+		}(r)
+	}
+
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return &MultiRegionError{Errors: errs}
+	}
+
+	return nil
+}
+
+func (m *MultiRegionClient) annotate(r region.Region, states []TunnelState) []RegionalTunnelState {
+	out := make([]RegionalTunnelState, len(states))
+	for i, s := range states {
+		out[i] = RegionalTunnelState{TunnelState: s, Region: r}
+		m.remember(s.ID, r)
+	}
+
+	return out
+}
+
+// sortStates sorts by region, in the configured order, keeping the order of
+// the API response within a region.
+func (m *MultiRegionClient) sortStates(states []RegionalTunnelState) {
+	order := make(map[string]int, len(m.regions))
+	for i, r := range m.regions {
+		order[r.Name] = i
+	}
+
+	sort.SliceStable(states, func(i, j int) bool {
+		return order[states[i].Region.Name] < order[states[j].Region.Name]
+	})
+}
+
+func (m *MultiRegionClient) remember(id string, r region.Region) {
+	m.mu.Lock()
+	m.tunnelRegions[id] = r.Name
+	m.mu.Unlock()
+}
+
+func (m *MultiRegionClient) tunnelRegion(id string) (region.Region, bool) {
+	m.mu.Lock()
+	name, ok := m.tunnelRegions[id]
+	m.mu.Unlock()
+
+	if !ok {
+		return region.Region{}, false
+	}
+
+	return m.region(name), true
+}
+
+func (m *MultiRegionClient) region(name string) region.Region {
+	for _, r := range m.regions {
+		if r.Name == name {
+			return r
+		}
+	}
+
+	return region.Region{Name: name}
+}
+
+func (m *MultiRegionClient) invalidRegion(name string) *region.InvalidRegionError {
+	available := make([]string, len(m.regions))
+	for i, r := range m.regions {
+		available[i] = fmt.Sprintf("%q", r.Name)
+	}
+
+	return &region.InvalidRegionError{
+		Available:       strings.Join(available, ", "),
+		SpecifiedRegion: region.Region{Name: name},
+	}
+}
@@ -0,0 +1,137 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/saucelabs/tunnelrest-go/region"
+	assertLib "github.com/stretchr/testify/assert"
+)
+
+func TestMultiRegionClient(t *testing.T) {
+	assert := assertLib.New(t)
+
+	_, usServer := newFakeTunnelAPI()
+	defer usServer.Close()
+
+	_, euServer := newFakeTunnelAPI()
+	defer euServer.Close()
+
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer broken.Close()
+
+	client := NewMultiRegionClient(
+		&Client{User: tunnelUser, APIKey: "password"},
+		[]region.Region{
+			{Name: "us-west", URL: usServer.URL},
+			{Name: "eu-central", URL: euServer.URL},
+			{Name: "apac-southeast", URL: broken.URL},
+		},
+	)
+
+	ctx := context.Background()
+
+	us, err := client.CreateTunnelV5(ctx, "us-west", &CreateTunnelRequestV5{TunnelIdentifier: "us"}, time.Second)
+	assert.NoError(err)
+
+	eu, err := client.CreateTunnelV5(ctx, "eu-central", &CreateTunnelRequestV5{TunnelIdentifier: "eu"}, time.Second)
+	assert.NoError(err)
+
+	_, err = client.CreateTunnelV5(ctx, "nowhere", &CreateTunnelRequestV5{}, time.Second)
+	var invalid *region.InvalidRegionError
+	assert.True(errors.As(err, &invalid), "InvalidRegionError is expected, got %v", err)
+
+	states, err := client.ListTunnelStates(ctx)
+	var multiErr *MultiRegionError
+	assert.True(errors.As(err, &multiErr), "MultiRegionError is expected, got %v", err)
+	assert.Contains(multiErr.Errors, "apac-southeast")
+	assert.Len(multiErr.Errors, 1)
+
+	assert.Len(states, 2)
+	assert.Equal("us", states[0].TunnelIdentifier)
+	assert.Equal("us-west", states[0].Region.Name)
+	assert.Equal("eu", states[1].TunnelIdentifier)
+	assert.Equal("eu-central", states[1].Region.Name)
+
+	shared, err := client.ListSharedTunnelStates(ctx)
+	assert.Error(err)
+	assert.Len(shared[tunnelUser], 2)
+
+	state, err := client.TunnelState(ctx, eu.ID)
+	assert.NoError(err)
+	assert.Equal("eu-central", state.Region.Name)
+
+	// A fresh client has to look the tunnel up in every region.
+	other := NewMultiRegionClient(&Client{User: tunnelUser}, client.Regions())
+	_, err = other.ShutdownTunnel(ctx, us.ID, "sigterm", false)
+	assert.NoError(err)
+
+	state, err = other.TunnelState(ctx, us.ID)
+	assert.NoError(err)
+	assert.Equal("us-west", state.Region.Name)
+	assert.Equal("terminated", state.Status)
+}
+
+func TestMultiRegionClientFatalMessage(t *testing.T) {
+	assert := assertLib.New(t)
+
+	api, _ := newFakeTunnelAPI()
+	server := httptest.NewServer(fatalOnCreate(api))
+	defer server.Close()
+
+	client := NewMultiRegionClient(
+		&Client{User: tunnelUser, APIKey: "password", FatalAsError: true},
+		[]region.Region{{Name: "us-west", URL: server.URL}},
+	)
+
+	ctx := context.Background()
+
+	tunnel, err := client.CreateTunnelV5(ctx, "us-west", &CreateTunnelRequestV5{TunnelIdentifier: "us"}, time.Second)
+	var fatalErr *FatalMessageError
+	assert.ErrorAs(err, &fatalErr)
+	assert.NotEmpty(tunnel.ID)
+
+	_, ok := client.tunnelRegion(tunnel.ID)
+	assert.True(ok)
+
+	_, err = client.ShutdownTunnel(ctx, tunnel.ID, "fatal", false)
+	assert.NoError(err)
+	assert.Equal(0, api.running())
+}
+
+func TestRegionalTunnelStateJSON(t *testing.T) {
+	assert := assertLib.New(t)
+
+	state := RegionalTunnelState{
+		TunnelState: TunnelState{
+			ID:     "1",
+			Region: "eu-central-1",
+			Extra:  map[string]json.RawMessage{"team": json.RawMessage(`"qa"`)},
+		},
+		Region: region.Region{Name: "eu-central", URL: "https://eu.example.com"},
+	}
+
+	data, err := json.Marshal(state)
+	assert.NoError(err)
+	assert.Contains(string(data), `"region":{"name":"eu-central","url":"https://eu.example.com"}`)
+	assert.Contains(string(data), `"tunnel_region":"eu-central-1"`)
+	assert.Contains(string(data), `"team":"qa"`)
+
+	var decoded RegionalTunnelState
+	assert.NoError(json.Unmarshal(data, &decoded))
+	assert.Equal(state, decoded)
+
+	decoded = RegionalTunnelState{}
+	assert.NoError(json.Unmarshal([]byte(`{"id": "2", "region": {"name": "eu"}}`), &decoded))
+	assert.Equal("2", decoded.ID)
+	assert.Equal("eu", decoded.Region.Name)
+	assert.Empty(decoded.TunnelState.Region)
+	assert.Empty(decoded.Extra)
+}
@@ -0,0 +1,398 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// PoolShutdownReason is the default reason used when the pool manager
+	// terminates a member.
+	PoolShutdownReason = "pool_manager"
+
+	defaultPoolCreateTimeout = 30 * time.Second
+	defaultPoolReadyTimeout  = 2 * time.Minute
+	defaultPoolPollInterval  = 5 * time.Second
+)
+
+var (
+	ErrPoolMissingIdentifier = errors.New("tunnel pool requires a tunnel identifier")
+	ErrPoolMemberNotReady    = errors.New("tunnel pool member did not become ready")
+	ErrPoolMemberMissingID   = errors.New("launched tunnel pool member has no ID")
+)
+
+// LaunchFunc starts a new pool member described by `req` and returns its
+// state as known right after the start. A member returned along with an
+// error, e.g. a *FatalMessageError, is shut down.
+type LaunchFunc func(ctx context.Context, req *CreateTunnelRequestV5) (TunnelState, error)
+
+// PoolMember is a tunnel managed by the PoolManager.
+type PoolMember struct {
+	// ID of the tunnel.
+	ID string
+	// State is the latest known tunnel state.
+	State TunnelState
+	// Started is the time the member was launched.
+	Started time.Time
+	// Generation of the request template the member was launched with.
+	Generation int
+}
+
+// Ready reports whether the member is ready to accept traffic.
+func (m PoolMember) Ready() bool {
+	return m.State.IsReady && !isTerminated(m.State)
+}
+
+// PoolManager maintains the desired number of tunnels sharing the same
+// `TunnelIdentifier`, replacing members that are shut down or unhealthy.
+type PoolManager struct {
+	// Client is used to query and terminate pool members.
+	Client *Client
+	// Request is the template used to launch new members. Its TunnelPool flag
+	// is always set.
+	Request CreateTunnelRequestV5
+	// Size is the desired number of members.
+	Size int
+	// MaxUnavailable is the maximum number of members replaced at once
+	// during a rolling replacement. Defaults to 1.
+	MaxUnavailable int
+
+	// CreateTimeout is the timeout of a single launch. Defaults to 30s.
+	CreateTimeout time.Duration
+	// ReadyTimeout is how long a member may stay not ready before it is
+	// considered unhealthy. Defaults to 2m.
+	ReadyTimeout time.Duration
+	// PollInterval is the interval between readiness checks. Defaults to 5s.
+	PollInterval time.Duration
+	// ShutdownReason is sent when a member is terminated. Defaults to
+	// PoolShutdownReason.
+	ShutdownReason string
+
+	// Launch starts a new member. If not set, the tunnel is created with
+	// Client.CreateTunnelV5.
+	Launch LaunchFunc
+
+	// opMu serializes Reconcile and Roll.
+	opMu sync.Mutex
+
+	// mu guards Request, Size and the fields below, once the pool is used.
+	mu         sync.Mutex
+	members    map[string]*PoolMember
+	generation int
+}
+
+// Members returns a snapshot of the pool members sorted by start time.
+func (p *PoolManager) Members() []PoolMember {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	members := make([]PoolMember, 0, len(p.members))
+	for _, m := range p.members {
+		members = append(members, *m)
+	}
+
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].Started.Before(members[j].Started)
+	})
+
+	return members
+}
+
+// Reconcile refreshes the state of every member, terminates the unhealthy
+// ones and launches new members until the desired size is reached.
+func (p *PoolManager) Reconcile(ctx context.Context) error {
+	p.opMu.Lock()
+	defer p.opMu.Unlock()
+
+	p.mu.Lock()
+	identifier, size := p.Request.TunnelIdentifier, p.Size
+	p.mu.Unlock()
+
+	if identifier == "" {
+		return ErrPoolMissingIdentifier
+	}
+
+	var firstErr error
+
+	for _, m := range p.Members() {
+		state, err := p.refresh(ctx, m.ID)
+		if err != nil && !isNotFound(err) {
+			// The API is unreachable, keep the member as is.
+			if firstErr == nil {
+				firstErr = err
+			}
+
+			continue
+		}
+
+		if err != nil || isTerminated(state) {
+			p.remove(m.ID)
+
+			continue
+		}
+
+		if !state.IsReady && time.Since(m.Started) > p.readyTimeout() {
+			if err := p.stop(ctx, m.ID); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	for n := len(p.Members()); n < size; n++ {
+		if _, err := p.launch(ctx); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+
+			break
+		}
+	}
+
+	return firstErr
+}
+
+// Run reconciles the pool every `interval` until `ctx` is done. Reconcile
+// errors are passed to `onError`, if set.
+func (p *PoolManager) Run(ctx context.Context, interval time.Duration, onError func(error)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := p.Reconcile(ctx); err != nil && onError != nil {
+			onError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Roll replaces every member with one launched from `req`, terminating at
+// most MaxUnavailable members at once and waiting for their replacements to
+// become ready before moving on. Reconcile waits for Roll to complete.
+func (p *PoolManager) Roll(ctx context.Context, req CreateTunnelRequestV5) error {
+	if req.TunnelIdentifier == "" {
+		return ErrPoolMissingIdentifier
+	}
+
+	p.opMu.Lock()
+	defer p.opMu.Unlock()
+
+	p.mu.Lock()
+	p.Request = req
+	p.generation++
+	generation := p.generation
+	p.mu.Unlock()
+
+	for {
+		var outdated []string
+
+		for _, m := range p.Members() {
+			if m.Generation < generation {
+				outdated = append(outdated, m.ID)
+			}
+		}
+
+		if len(outdated) == 0 {
+			return nil
+		}
+
+		if len(outdated) > p.maxUnavailable() {
+			outdated = outdated[:p.maxUnavailable()]
+		}
+
+		for _, id := range outdated {
+			if err := p.stop(ctx, id); err != nil {
+				return err
+			}
+		}
+
+		for range outdated {
+			m, err := p.launch(ctx)
+			if err != nil {
+				return err
+			}
+
+			if err := p.waitReady(ctx, m.ID); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Shutdown terminates every member of the pool.
+func (p *PoolManager) Shutdown(ctx context.Context) error {
+	var firstErr error
+
+	for _, m := range p.Members() {
+		if err := p.stop(ctx, m.ID); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+func (p *PoolManager) launch(ctx context.Context) (PoolMember, error) {
+	p.mu.Lock()
+	req := p.Request
+	generation := p.generation
+	p.mu.Unlock()
+
+	req.TunnelPool = true
+
+	launch := p.Launch
+	if launch == nil {
+		launch = func(ctx context.Context, req *CreateTunnelRequestV5) (TunnelState, error) {
+			tunnel, err := p.Client.CreateTunnelV5(ctx, req, p.createTimeout())
+
+			return tunnel.TunnelState, err
+		}
+	}
+
+	state, err := launch(ctx, &req)
+	if err != nil {
+		// The tunnel may have been created, e.g. with fatal messages.
+		if state.ID != "" {
+			if stopErr := p.stop(ctx, state.ID); stopErr != nil {
+				err = fmt.Errorf("%w, and failed to shut it down: %v", err, stopErr)
+			}
+		}
+
+		return PoolMember{}, fmt.Errorf("failed to launch %q pool member: %w", req.TunnelIdentifier, err)
+	}
+
+	// Members are tracked by ID.
+	if state.ID == "" {
+		return PoolMember{}, fmt.Errorf("failed to launch %q pool member: %w", req.TunnelIdentifier, ErrPoolMemberMissingID)
+	}
+
+	m := &PoolMember{
+		ID:         state.ID,
+		State:      state,
+		Started:    time.Now(),
+		Generation: generation,
+	}
+
+	p.mu.Lock()
+	if p.members == nil {
+		p.members = make(map[string]*PoolMember)
+	}
+	p.members[m.ID] = m
+	p.mu.Unlock()
+
+	return *m, nil
+}
+
+func (p *PoolManager) refresh(ctx context.Context, id string) (TunnelState, error) {
+	state, err := p.Client.TunnelState(ctx, id)
+	if err != nil {
+		return state, err
+	}
+
+	p.mu.Lock()
+	if m, ok := p.members[id]; ok {
+		m.State = state
+	}
+	p.mu.Unlock()
+
+	return state, nil
+}
+
+func (p *PoolManager) waitReady(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, p.readyTimeout())
+	defer cancel()
+
+	ticker := time.NewTicker(p.pollInterval())
+	defer ticker.Stop()
+
+	for {
+		state, err := p.refresh(ctx, id)
+		if err == nil && state.IsReady {
+			return nil
+		}
+
+		if err == nil && isTerminated(state) {
+			p.remove(id)
+
+			return fmt.Errorf("%w: %s is %s", ErrPoolMemberNotReady, id, state.Status)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %s: %v", ErrPoolMemberNotReady, id, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *PoolManager) stop(ctx context.Context, id string) error {
+	reason := p.ShutdownReason
+	if reason == "" {
+		reason = PoolShutdownReason
+	}
+
+	if _, err := p.Client.ShutdownTunnel(ctx, id, reason, false); err != nil && !isNotFound(err) {
+		return err
+	}
+
+	p.remove(id)
+
+	return nil
+}
+
+func (p *PoolManager) remove(id string) {
+	p.mu.Lock()
+	delete(p.members, id)
+	p.mu.Unlock()
+}
+
+func (p *PoolManager) maxUnavailable() int {
+	if p.MaxUnavailable < 1 {
+		return 1
+	}
+
+	return p.MaxUnavailable
+}
+
+func (p *PoolManager) createTimeout() time.Duration {
+	if p.CreateTimeout <= 0 {
+		return defaultPoolCreateTimeout
+	}
+
+	return p.CreateTimeout
+}
+
+func (p *PoolManager) readyTimeout() time.Duration {
+	if p.ReadyTimeout <= 0 {
+		return defaultPoolReadyTimeout
+	}
+
+	return p.ReadyTimeout
+}
+
+func (p *PoolManager) pollInterval() time.Duration {
+	if p.PollInterval <= 0 {
+		return defaultPoolPollInterval
+	}
+
+	return p.PollInterval
+}
+
+func isTerminated(state TunnelState) bool {
+	return state.Status == TunnelStatusTerminated || state.ShutdownTime != 0
+}
+
+func isNotFound(err error) bool {
+	var cE *ClientError
+
+	return errors.As(err, &cE) && cE.StatusCode == http.StatusNotFound
+}
@@ -0,0 +1,315 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	assertLib "github.com/stretchr/testify/assert"
+)
+
+// fakeTunnelSeq makes tunnel IDs unique across fake APIs.
+var fakeTunnelSeq int64
+
+// fakeTunnelAPI is a minimal in-memory implementation of the tunnels REST API.
+type fakeTunnelAPI struct {
+	mu      sync.Mutex
+	tunnels map[string]*TunnelState
+	// readyOnCreate marks new tunnels as ready right away.
+	readyOnCreate bool
+	// heartbeats counts the client status updates per tunnel.
+	heartbeats map[string]int
+}
+
+func newFakeTunnelAPI() (*fakeTunnelAPI, *httptest.Server) {
+	api := &fakeTunnelAPI{
+		tunnels:       make(map[string]*TunnelState),
+		readyOnCreate: true,
+		heartbeats:    make(map[string]int),
+	}
+
+	return api, httptest.NewServer(api)
+}
+
+func (f *fakeTunnelAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 2 || parts[1] != "tunnels" {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch {
+	case len(parts) == 2 && r.Method == http.MethodPost:
+		var req CreateTunnelRequestV5
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		state := &TunnelState{
+			ID:               fmt.Sprintf("tunnel-%d", atomic.AddInt64(&fakeTunnelSeq, 1)),
+			Owner:            parts[0],
+			Status:           "running",
+			IsReady:          f.readyOnCreate,
+			TunnelIdentifier: req.TunnelIdentifier,
+			CreationTime:     int(time.Now().Unix()),
+			Metadata:         req.Metadata,
+		}
+		f.tunnels[state.ID] = state
+		_ = json.NewEncoder(w).Encode(state)
+	case len(parts) == 2 && r.Method == http.MethodGet:
+		states := []TunnelState{}
+		for _, s := range f.tunnels {
+			if s.Status == "running" {
+				states = append(states, *s)
+			}
+		}
+		if r.URL.Query().Get("all") == "1" {
+			_ = json.NewEncoder(w).Encode(map[string][]TunnelState{parts[0]: states})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(states)
+	case len(parts) == 3 && r.Method == http.MethodGet:
+		s, ok := f.tunnels[parts[2]]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(s)
+	case len(parts) == 3 && r.Method == http.MethodDelete:
+		s, ok := f.tunnels[parts[2]]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		s.Status = "terminated"
+		s.IsReady = false
+		s.ShutdownReason = r.URL.Query().Get("reason")
+		_, _ = w.Write([]byte(`{"jobs_running": 0}`))
+	case len(parts) == 4 && parts[3] == "connected" && r.Method == http.MethodPost:
+		f.heartbeats[parts[2]]++
+		_ = json.NewEncoder(w).Encode(UpdateClientStatusResponse{ID: parts[2], Result: true})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeTunnelAPI) set(id string, fn func(*TunnelState)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fn(f.tunnels[id])
+}
+
+func (f *fakeTunnelAPI) running() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	n := 0
+	for _, s := range f.tunnels {
+		if s.Status == "running" {
+			n++
+		}
+	}
+
+	return n
+}
+
+func TestPoolManagerReconcile(t *testing.T) {
+	assert := assertLib.New(t)
+	api, server := newFakeTunnelAPI()
+	defer server.Close()
+
+	pool := &PoolManager{
+		Client:       &Client{BaseURL: server.URL, User: tunnelUser, APIKey: "password"},
+		Request:      CreateTunnelRequestV5{TunnelIdentifier: "grid"},
+		Size:         3,
+		ReadyTimeout: time.Minute,
+	}
+
+	assert.NoError(pool.Reconcile(context.Background()))
+	members := pool.Members()
+	assert.Len(members, 3)
+	assert.Equal(3, api.running())
+
+	// One member is shut down out of band, it must be replaced.
+	api.set(members[0].ID, func(s *TunnelState) { s.Status = "terminated" })
+
+	assert.NoError(pool.Reconcile(context.Background()))
+	members = pool.Members()
+	assert.Len(members, 3)
+	assert.Equal(3, api.running())
+
+	for _, m := range members {
+		assert.True(m.Ready(), "member %s is expected to be ready", m.ID)
+		assert.Equal("grid", m.State.TunnelIdentifier)
+	}
+}
+
+func TestPoolManagerReplacesUnhealthy(t *testing.T) {
+	assert := assertLib.New(t)
+	api, server := newFakeTunnelAPI()
+	defer server.Close()
+
+	api.readyOnCreate = false
+
+	pool := &PoolManager{
+		Client:       &Client{BaseURL: server.URL, User: tunnelUser, APIKey: "password"},
+		Request:      CreateTunnelRequestV5{TunnelIdentifier: "grid"},
+		Size:         1,
+		ReadyTimeout: time.Millisecond,
+	}
+
+	assert.NoError(pool.Reconcile(context.Background()))
+	first := pool.Members()[0].ID
+
+	time.Sleep(5 * time.Millisecond)
+
+	assert.NoError(pool.Reconcile(context.Background()))
+	members := pool.Members()
+	assert.Len(members, 1)
+	assert.NotEqual(first, members[0].ID, "unhealthy member is expected to be replaced")
+	assert.Equal(1, api.running())
+}
+
+func TestPoolManagerRoll(t *testing.T) {
+	assert := assertLib.New(t)
+	api, server := newFakeTunnelAPI()
+	defer server.Close()
+
+	pool := &PoolManager{
+		Client:         &Client{BaseURL: server.URL, User: tunnelUser, APIKey: "password"},
+		Request:        CreateTunnelRequestV5{TunnelIdentifier: "grid"},
+		Size:           3,
+		MaxUnavailable: 2,
+		PollInterval:   time.Millisecond,
+	}
+
+	assert.NoError(pool.Reconcile(context.Background()))
+
+	old := map[string]bool{}
+	for _, m := range pool.Members() {
+		old[m.ID] = true
+	}
+
+	next := CreateTunnelRequestV5{
+		TunnelIdentifier: "grid",
+		Metadata:         Metadata{Release: "5.1.0"},
+	}
+	assert.NoError(pool.Roll(context.Background(), next))
+
+	members := pool.Members()
+	assert.Len(members, 3)
+	assert.Equal(3, api.running())
+
+	for _, m := range members {
+		assert.False(old[m.ID], "member %s is expected to be replaced", m.ID)
+		assert.Equal(1, m.Generation)
+		assert.Equal("5.1.0", m.State.Metadata.Release)
+	}
+}
+
+func TestPoolManagerMissingIdentifier(t *testing.T) {
+	pool := &PoolManager{Client: &Client{}, Size: 1}
+
+	assertLib.ErrorIs(t, pool.Reconcile(context.Background()), ErrPoolMissingIdentifier)
+}
+
+func TestPoolManagerMissingID(t *testing.T) {
+	assert := assertLib.New(t)
+
+	launches := 0
+	pool := &PoolManager{
+		Client:  &Client{},
+		Request: CreateTunnelRequestV5{TunnelIdentifier: "grid"},
+		Size:    2,
+		Launch: func(ctx context.Context, req *CreateTunnelRequestV5) (TunnelState, error) {
+			launches++
+
+			return TunnelState{}, nil
+		},
+	}
+
+	assert.ErrorIs(pool.Reconcile(context.Background()), ErrPoolMemberMissingID)
+	assert.Equal(1, launches)
+	assert.Empty(pool.Members())
+}
+
+// fatalOnCreate serves `api`, adding a fatal message to created tunnels.
+func fatalOnCreate(api *fakeTunnelAPI) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			api.ServeHTTP(w, r)
+
+			return
+		}
+
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, r)
+
+		var tunnel TunnelStateWithMessages
+		_ = json.Unmarshal(rec.Body.Bytes(), &tunnel)
+		tunnel.Messages.Fatal = []string{"version is blocked"}
+		_ = json.NewEncoder(w).Encode(tunnel)
+	})
+}
+
+func TestPoolManagerFatalMessage(t *testing.T) {
+	assert := assertLib.New(t)
+	api, _ := newFakeTunnelAPI()
+	server := httptest.NewServer(fatalOnCreate(api))
+	defer server.Close()
+
+	pool := &PoolManager{
+		Client:  &Client{BaseURL: server.URL, User: tunnelUser, APIKey: "password", FatalAsError: true},
+		Request: CreateTunnelRequestV5{TunnelIdentifier: "grid"},
+		Size:    1,
+	}
+
+	var fatalErr *FatalMessageError
+	assert.ErrorAs(pool.Reconcile(context.Background()), &fatalErr)
+	assert.Empty(pool.Members())
+	assert.Equal(0, api.running())
+}
+
+func TestPoolManagerRollDuringRun(t *testing.T) {
+	assert := assertLib.New(t)
+	api, server := newFakeTunnelAPI()
+	defer server.Close()
+
+	pool := &PoolManager{
+		Client:       &Client{BaseURL: server.URL, User: tunnelUser, APIKey: "password"},
+		Request:      CreateTunnelRequestV5{TunnelIdentifier: "grid"},
+		Size:         2,
+		PollInterval: time.Millisecond,
+	}
+
+	assert.NoError(pool.Reconcile(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		_ = pool.Run(ctx, time.Millisecond, nil)
+	}()
+
+	for i := 0; i < 3; i++ {
+		next := CreateTunnelRequestV5{TunnelIdentifier: "grid", Metadata: Metadata{Release: fmt.Sprint(i)}}
+		assert.NoError(pool.Roll(context.Background(), next))
+		assert.LessOrEqual(api.running(), 2)
+	}
+
+	cancel()
+	<-done
+
+	assert.Len(pool.Members(), 2)
+	assert.Equal(2, api.running())
+}
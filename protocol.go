@@ -7,3 +7,15 @@ type Protocol string
 func (p *Protocol) String() string {
 	return string(*p)
 }
+
+// GroupByProtocol returns `states` per protocol, in order. Tunnels without a
+// protocol, e.g. returned by an older server, are grouped under "".
+func GroupByProtocol(states []TunnelState) map[Protocol][]TunnelState {
+	groups := make(map[Protocol][]TunnelState)
+
+	for _, s := range states {
+		groups[s.Protocol] = append(groups[s.Protocol], s)
+	}
+
+	return groups
+}
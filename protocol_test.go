@@ -1,6 +1,9 @@
 package rest
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+)
 
 func TestProtocol_String(t *testing.T) {
 	var customProtocol Protocol = "customProtocol"
@@ -24,3 +27,28 @@ func TestProtocol_String(t *testing.T) {
 		})
 	}
 }
+
+func TestGroupByProtocol(t *testing.T) {
+	groups := GroupByProtocol([]TunnelState{
+		{ID: "1", Protocol: H2CProtocol},
+		{ID: "2", Protocol: KGPProtocol},
+		{ID: "3", Protocol: H2CProtocol},
+		{ID: "4"},
+	})
+
+	want := map[Protocol][]string{
+		H2CProtocol: {"1", "3"},
+		KGPProtocol: {"2"},
+		"":          {"4"},
+	}
+
+	if len(groups) != len(want) {
+		t.Fatalf("GroupByProtocol() = %v, want %v", groups, want)
+	}
+
+	for p, ids := range want {
+		if got := tunnelStatesToIDs(groups[p]); !reflect.DeepEqual(got, ids) {
+			t.Errorf("GroupByProtocol()[%q] = %v, want %v", p, got, ids)
+		}
+	}
+}
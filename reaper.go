@@ -0,0 +1,291 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// ReaperShutdownReason is the default reason used when the reaper shuts down
+// an orphaned tunnel.
+const ReaperShutdownReason = "reaped_orphan"
+
+// ErrReaperNoLiveHosts is returned when ReaperRules.LiveHosts returns no host,
+// unless ReaperRules.AllowNoLiveHosts is set.
+var ErrReaperNoLiveHosts = errors.New("live hosts: no host returned")
+
+// ReaperRules identify orphaned tunnels. A tunnel in scope is an orphan if
+// any of the enabled rules matches. Nothing is reaped if no rule is enabled.
+type ReaperRules struct {
+	// Identifiers restrict the scope to tunnels with a matching identifier.
+	// All tunnels are in scope if empty.
+	Identifiers []*regexp.Regexp
+
+	// MaxAge matches tunnels created longer ago, based on CreationTime.
+	MaxAge time.Duration
+	// LiveHosts, if set, returns the hosts currently running tunnels, e.g.
+	// the CI runners. Tunnels with a Metadata.Hostname not in the list
+	// match. Tunnels without a hostname don't. An empty list, e.g. from a
+	// broken inventory, would match every tunnel with a hostname, so the
+	// pass fails with ErrReaperNoLiveHosts instead, unless AllowNoLiveHosts
+	// is set.
+	LiveHosts func(ctx context.Context) ([]string, error)
+	// AllowNoLiveHosts lets LiveHosts return an empty list, e.g. when all the
+	// runners are really gone.
+	AllowNoLiveHosts bool
+	// NotReady matches tunnels that aren't ready anymore, once they're older
+	// than NotReadyGrace.
+	NotReady bool
+	// NotReadyGrace gives starting tunnels time to become ready.
+	NotReadyGrace time.Duration
+}
+
+func (r ReaperRules) enabled() bool {
+	return r.MaxAge > 0 || r.LiveHosts != nil || r.NotReady
+}
+
+// ReapAction is an orphan found by the reaper.
+type ReapAction struct {
+	Tunnel TunnelState
+	// Reasons are the rules the tunnel matched.
+	Reasons []string
+	// DryRun is set if the tunnel was left running.
+	DryRun bool
+	// Err is the shutdown error, if any.
+	Err error
+}
+
+// ReapReport is the report of a reaper pass.
+type ReapReport struct {
+	Time time.Time
+	// Scanned is the number of running tunnels found.
+	Scanned int
+	// Allowed are the IDs of orphans left running because of the
+	// allow-lists.
+	Allowed []string
+	// Actions are the orphans, shut down unless in dry-run.
+	Actions []ReapAction
+}
+
+// Reaper shuts down orphaned tunnels, e.g. left running by crashed CI
+// runners.
+type Reaper struct {
+	// Client is used to list and shut down tunnels.
+	Client *Client
+	// Rules identify orphans.
+	Rules ReaperRules
+	// Shared also scans the tunnels shared by other users in the org.
+	Shared bool
+
+	// AllowIDs, AllowOwners and AllowIdentifiers are never reaped.
+	AllowIDs         []string
+	AllowOwners      []string
+	AllowIdentifiers []*regexp.Regexp
+
+	// DryRun reports the orphans without shutting them down.
+	DryRun bool
+	// ShutdownReason is sent when an orphan is shut down. Defaults to
+	// ReaperShutdownReason.
+	ShutdownReason string
+	// Wait for the jobs of orphans to finish before shutting them down.
+	Wait bool
+}
+
+// Run reaps every `interval` until `ctx` is done. Each pass report is passed
+// to `onReport`, if set.
+func (r *Reaper) Run(ctx context.Context, interval time.Duration, onReport func(ReapReport, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		report, err := r.Reap(ctx)
+		if onReport != nil {
+			onReport(report, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Reap scans the running tunnels, and shuts the orphans down. Shutdown
+// errors are reported per action, the returned error is about the scan.
+func (r *Reaper) Reap(ctx context.Context) (ReapReport, error) {
+	report := ReapReport{Time: time.Now()}
+
+	if !r.Rules.enabled() {
+		return report, nil
+	}
+
+	states, err := r.scan(ctx)
+	if err != nil {
+		return report, err
+	}
+
+	report.Scanned = len(states)
+
+	var liveHosts map[string]bool
+
+	if r.Rules.LiveHosts != nil {
+		hosts, err := r.Rules.LiveHosts(ctx)
+		if err != nil {
+			return report, fmt.Errorf("live hosts: %w", err)
+		}
+
+		if len(hosts) == 0 && !r.Rules.AllowNoLiveHosts {
+			return report, ErrReaperNoLiveHosts
+		}
+
+		liveHosts = make(map[string]bool, len(hosts))
+		for _, h := range hosts {
+			liveHosts[h] = true
+		}
+	}
+
+	for _, state := range states {
+		if !r.inScope(state) {
+			continue
+		}
+
+		reasons := r.match(state, liveHosts, report.Time)
+		if len(reasons) == 0 {
+			continue
+		}
+
+		if r.allowed(state) {
+			report.Allowed = append(report.Allowed, state.ID)
+
+			continue
+		}
+
+		action := ReapAction{Tunnel: state, Reasons: reasons, DryRun: r.DryRun}
+		if !r.DryRun {
+			action.Err = r.shutdown(ctx, state)
+		}
+
+		report.Actions = append(report.Actions, action)
+	}
+
+	return report, nil
+}
+
+// scan returns the running tunnels, sorted by ID.
+func (r *Reaper) scan(ctx context.Context) ([]TunnelState, error) {
+	own, err := r.Client.listTunnels(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]TunnelState, len(own))
+	for _, s := range own {
+		byID[s.ID] = s
+	}
+
+	if r.Shared {
+		shared, err := r.Client.listSharedTunnels(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, states := range shared {
+			for _, s := range states {
+				byID[s.ID] = s
+			}
+		}
+	}
+
+	states := make([]TunnelState, 0, len(byID))
+
+	for _, s := range byID {
+		if !isTerminated(s) {
+			states = append(states, s)
+		}
+	}
+
+	sort.Slice(states, func(i, j int) bool { return states[i].ID < states[j].ID })
+
+	return states, nil
+}
+
+func (r *Reaper) inScope(state TunnelState) bool {
+	if len(r.Rules.Identifiers) == 0 {
+		return true
+	}
+
+	return matchAny(r.Rules.Identifiers, state.TunnelIdentifier)
+}
+
+func (r *Reaper) match(state TunnelState, liveHosts map[string]bool, now time.Time) []string {
+	var reasons []string
+
+	// Without a creation time, the age is unknown, and the age based rules
+	// don't apply.
+	known := state.CreationTime != 0
+	age := now.Sub(time.Unix(int64(state.CreationTime), 0))
+
+	if known && r.Rules.MaxAge > 0 && age > r.Rules.MaxAge {
+		reasons = append(reasons, fmt.Sprintf("older than %s", r.Rules.MaxAge))
+	}
+
+	if host := state.Metadata.Hostname; liveHosts != nil && host != "" && !liveHosts[host] {
+		reasons = append(reasons, fmt.Sprintf("host %q is not live", host))
+	}
+
+	if known && r.Rules.NotReady && !state.IsReady && age > r.Rules.NotReadyGrace {
+		reasons = append(reasons, "not ready")
+	}
+
+	return reasons
+}
+
+func (r *Reaper) allowed(state TunnelState) bool {
+	return contains(r.AllowIDs, state.ID) ||
+		contains(r.AllowOwners, state.Owner) ||
+		matchAny(r.AllowIdentifiers, state.TunnelIdentifier)
+}
+
+func (r *Reaper) shutdown(ctx context.Context, state TunnelState) error {
+	reason := r.ShutdownReason
+	if reason == "" {
+		reason = ReaperShutdownReason
+	}
+
+	c := r.Client
+
+	// Shared tunnels are shut down on behalf of their owner.
+	if state.Owner != "" && state.Owner != c.getTunnelOwnerUsername() {
+		owned := *c
+		owned.TunnelOwner = state.Owner
+		c = &owned
+	}
+
+	_, err := c.shutdown(ctx, state.ID, reason, r.Wait)
+
+	return err
+}
+
+func matchAny(patterns []*regexp.Regexp, s string) bool {
+	for _, re := range patterns {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
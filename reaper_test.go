@@ -0,0 +1,176 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	assertLib "github.com/stretchr/testify/assert"
+)
+
+func TestReaper(t *testing.T) {
+	assert := assertLib.New(t)
+
+	api, server := newFakeTunnelAPI()
+	defer server.Close()
+
+	c := &Client{BaseURL: server.URL, User: tunnelUser}
+
+	create := func(identifier, host string, age time.Duration, ready bool) string {
+		tunnel, err := c.CreateTunnelV5(context.Background(), &CreateTunnelRequestV5{
+			TunnelIdentifier: identifier,
+			Metadata:         Metadata{Hostname: host},
+		}, time.Second)
+		assert.NoError(err)
+
+		api.set(tunnel.ID, func(s *TunnelState) {
+			s.CreationTime = int(time.Now().Add(-age).Unix())
+			s.IsReady = ready
+		})
+
+		return tunnel.ID
+	}
+
+	old := create("ci-1", "runner-1", 3*time.Hour, true)
+	deadHost := create("ci-2", "runner-dead", time.Minute, true)
+	notReady := create("ci-3", "runner-1", time.Hour, false)
+	starting := create("ci-4", "runner-1", time.Second, false)
+	outOfScope := create("prod", "runner-dead", 3*time.Hour, true)
+	allowed := create("ci-keep", "runner-dead", time.Minute, true)
+
+	r := &Reaper{
+		Client: c,
+		Shared: true,
+		Rules: ReaperRules{
+			Identifiers: []*regexp.Regexp{regexp.MustCompile(`^ci-`)},
+			MaxAge:      2 * time.Hour,
+			LiveHosts: func(context.Context) ([]string, error) {
+				return []string{"runner-1"}, nil
+			},
+			NotReady:      true,
+			NotReadyGrace: time.Minute,
+		},
+		AllowIdentifiers: []*regexp.Regexp{regexp.MustCompile(`keep`)},
+		DryRun:           true,
+	}
+
+	report, err := r.Reap(context.Background())
+	assert.NoError(err)
+	assert.Equal(6, report.Scanned)
+	assert.Equal([]string{allowed}, report.Allowed)
+
+	reasons := map[string][]string{}
+	for _, a := range report.Actions {
+		assert.True(a.DryRun)
+		reasons[a.Tunnel.ID] = a.Reasons
+	}
+
+	assert.Equal(map[string][]string{
+		old:      {"older than 2h0m0s"},
+		deadHost: {`host "runner-dead" is not live`},
+		notReady: {"not ready"},
+	}, reasons)
+	assert.Equal(6, api.running())
+
+	r.DryRun = false
+
+	report, err = r.Reap(context.Background())
+	assert.NoError(err)
+	assert.Len(report.Actions, 3)
+	assert.Equal(3, api.running())
+
+	for _, a := range report.Actions {
+		assert.NoError(a.Err)
+
+		state, _ := c.TunnelState(context.Background(), a.Tunnel.ID)
+		assert.Equal(ReaperShutdownReason, state.ShutdownReason)
+	}
+
+	for _, id := range []string{starting, outOfScope, allowed} {
+		state, _ := c.TunnelState(context.Background(), id)
+		assert.Equal("running", state.Status)
+	}
+}
+
+func TestReaperUnknownCreationTime(t *testing.T) {
+	assert := assertLib.New(t)
+
+	r := &Reaper{Rules: ReaperRules{MaxAge: time.Hour, NotReady: true, NotReadyGrace: time.Minute}}
+	now := time.Now()
+
+	// The age isn't counted from the Unix epoch.
+	assert.Empty(r.match(TunnelState{ID: "1"}, nil, now))
+
+	// Other rules still apply.
+	reasons := r.match(TunnelState{ID: "1", Metadata: Metadata{Hostname: "runner-dead"}}, map[string]bool{}, now)
+	assert.Equal([]string{`host "runner-dead" is not live`}, reasons)
+
+	old := TunnelState{ID: "2", CreationTime: int(now.Add(-2 * time.Hour).Unix())}
+	assert.Equal([]string{"older than 1h0m0s", "not ready"}, r.match(old, nil, now))
+}
+
+func TestReaperNoRules(t *testing.T) {
+	assert := assertLib.New(t)
+
+	api, server := newFakeTunnelAPI()
+	defer server.Close()
+
+	c := &Client{BaseURL: server.URL, User: tunnelUser}
+	_, err := c.CreateTunnelV5(context.Background(), &CreateTunnelRequestV5{}, time.Second)
+	assert.NoError(err)
+
+	report, err := (&Reaper{Client: c}).Reap(context.Background())
+	assert.NoError(err)
+	assert.Empty(report.Actions)
+	assert.Equal(1, api.running())
+}
+
+func TestReaperLiveHostsError(t *testing.T) {
+	assert := assertLib.New(t)
+
+	_, server := newFakeTunnelAPI()
+	defer server.Close()
+
+	r := &Reaper{
+		Client: &Client{BaseURL: server.URL, User: tunnelUser},
+		Rules: ReaperRules{LiveHosts: func(context.Context) ([]string, error) {
+			return nil, errors.New("inventory unavailable")
+		}},
+	}
+
+	_, err := r.Reap(context.Background())
+	assert.EqualError(err, "live hosts: inventory unavailable")
+}
+
+func TestReaperNoLiveHosts(t *testing.T) {
+	assert := assertLib.New(t)
+
+	api, server := newFakeTunnelAPI()
+	defer server.Close()
+
+	c := &Client{BaseURL: server.URL, User: tunnelUser}
+	_, err := c.CreateTunnelV5(context.Background(), &CreateTunnelRequestV5{Metadata: Metadata{Hostname: "runner-1"}}, time.Second)
+	assert.NoError(err)
+
+	r := &Reaper{
+		Client: c,
+		Rules: ReaperRules{LiveHosts: func(context.Context) ([]string, error) {
+			return nil, nil
+		}},
+	}
+
+	// An empty inventory doesn't reap every tunnel.
+	report, err := r.Reap(context.Background())
+	assert.ErrorIs(err, ErrReaperNoLiveHosts)
+	assert.Empty(report.Actions)
+	assert.Equal(1, api.running())
+
+	r.Rules.AllowNoLiveHosts = true
+
+	report, err = r.Reap(context.Background())
+	assert.NoError(err)
+	assert.Len(report.Actions, 1)
+	assert.Equal(0, api.running())
+}
@@ -0,0 +1,103 @@
+package region
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Known are the Sauce Labs data center regions.
+var Known = []Region{
+	{Name: "us-west-1", URL: "https://api.us-west-1.saucelabs.com/rest/v1"},
+	{Name: "us-east-4", URL: "https://api.us-east-4.saucelabs.com/rest/v1"},
+	{Name: "eu-central-1", URL: "https://api.eu-central-1.saucelabs.com/rest/v1"},
+	{Name: "apac-southeast-1", URL: "https://api.apac-southeast-1.saucelabs.com/rest/v1"},
+}
+
+// aliases are the short region names accepted by Sauce Connect.
+var aliases = map[string]string{
+	"us":             "us-west-1",
+	"us-west":        "us-west-1",
+	"us-east":        "us-east-4",
+	"eu":             "eu-central-1",
+	"eu-central":     "eu-central-1",
+	"apac":           "apac-southeast-1",
+	"apac-southeast": "apac-southeast-1",
+}
+
+// Lookup returns the known region `name`, short names e.g. "eu" are
+// accepted. Unknown regions return an *InvalidRegionError with a suggestion.
+func Lookup(name string) (Region, error) {
+	n := strings.ToLower(strings.TrimSpace(name))
+	if alias, ok := aliases[n]; ok {
+		n = alias
+	}
+
+	for _, r := range Known {
+		if r.Name == n {
+			return r, nil
+		}
+	}
+
+	available := make([]string, len(Known))
+	for i, r := range Known {
+		available[i] = fmt.Sprintf("%q", r.Name)
+	}
+
+	return Region{}, &InvalidRegionError{
+		Available:       strings.Join(available, ", "),
+		PossibleRegion:  suggest(n),
+		SpecifiedRegion: Region{Name: name},
+	}
+}
+
+// suggest returns the known region closest to `name`, if any is close enough.
+func suggest(name string) Region {
+	best, bestDistance := Region{}, 4
+
+	for _, r := range Known {
+		for _, candidate := range []string{r.Name, strings.TrimRight(r.Name, "-0123456789")} {
+			if d := distance(name, candidate); d < bestDistance {
+				best, bestDistance = r, d
+			}
+		}
+	}
+
+	return best
+}
+
+// distance is the Levenshtein distance of `a` and `b`.
+func distance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+
+		prev = cur
+	}
+
+	return prev[len(b)]
+}
+
+func minInt(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+
+	return m
+}
@@ -0,0 +1,28 @@
+package region
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLookup(t *testing.T) {
+	r, err := Lookup("eu-central-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://api.eu-central-1.saucelabs.com/rest/v1", r.URL)
+
+	r, err = Lookup("US-West")
+	assert.NoError(t, err)
+	assert.Equal(t, "us-west-1", r.Name)
+
+	_, err = Lookup("eu-centrl")
+	var iR *InvalidRegionError
+	assert.True(t, errors.As(err, &iR))
+	assert.Equal(t, "eu-central-1", iR.PossibleRegion.Name)
+	assert.Contains(t, err.Error(), `Did you meant "eu-central-1"`)
+
+	_, err = Lookup("mars")
+	assert.True(t, errors.As(err, &iR))
+	assert.Equal(t, Region{}, iR.PossibleRegion)
+}
@@ -0,0 +1,233 @@
+package region
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultProbeSamples = 3
+	defaultProbeTimeout = 5 * time.Second
+)
+
+// DialFunc opens network connections.
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// ProbeOptions configures Probe.
+type ProbeOptions struct {
+	// Samples is the number of measurements per region. Defaults to 3.
+	Samples int
+	// Timeout of a single measurement. Defaults to 5s.
+	Timeout time.Duration
+	// DialContext opens the TCP connections. Defaults to net.Dialer.
+	DialContext DialFunc
+	// TLSConfig is used for "https" region URLs.
+	TLSConfig *tls.Config
+}
+
+// ProbeStats are statistics of the measured durations.
+type ProbeStats struct {
+	Min    time.Duration
+	Max    time.Duration
+	Mean   time.Duration
+	Median time.Duration
+}
+
+// ProbeResult is the outcome of probing a region.
+type ProbeResult struct {
+	Region Region
+	// Connect is the TCP connect time.
+	Connect ProbeStats
+	// TLS is the TLS handshake time, zero for "http" URLs.
+	TLS ProbeStats
+	// RoundTrip is the time from sending the request to receiving the
+	// response headers, connection setup included.
+	RoundTrip ProbeStats
+	// Samples is the number of successful measurements.
+	Samples int
+	// Err is the last measurement error, if any.
+	Err error
+}
+
+// OK reports whether at least one measurement succeeded.
+func (r ProbeResult) OK() bool {
+	return r.Samples > 0
+}
+
+type probeSample struct {
+	connect, tls, roundTrip time.Duration
+}
+
+// Probe measures the latency of every region concurrently. Any HTTP response
+// counts as a successful round trip. Results are ranked by median round trip
+// time, regions that couldn't be reached come last.
+func Probe(ctx context.Context, regions []Region, opts ProbeOptions) []ProbeResult {
+	if opts.Samples <= 0 {
+		opts.Samples = defaultProbeSamples
+	}
+
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultProbeTimeout
+	}
+
+	if opts.DialContext == nil {
+		opts.DialContext = (&net.Dialer{}).DialContext
+	}
+
+	results := make([]ProbeResult, len(regions))
+
+	var wg sync.WaitGroup
+
+	for i, r := range regions {
+		wg.Add(1)
+
+		go func(i int, r Region) {
+			defer wg.Done()
+
+			results[i] = probeRegion(ctx, r, opts)
+		}(i, r)
+	}
+
+	wg.Wait()
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].OK() != results[j].OK() {
+			return results[i].OK()
+		}
+
+		return results[i].RoundTrip.Median < results[j].RoundTrip.Median
+	})
+
+	return results
+}
+
+// Fastest returns the region with the lowest median round trip time.
+func Fastest(results []ProbeResult) (Region, bool) {
+	for _, r := range results {
+		if r.OK() {
+			return r.Region, true
+		}
+	}
+
+	return Region{}, false
+}
+
+func probeRegion(ctx context.Context, r Region, opts ProbeOptions) ProbeResult {
+	result := ProbeResult{Region: r}
+
+	var samples []probeSample
+
+	for i := 0; i < opts.Samples; i++ {
+		s, err := probeOnce(ctx, r.URL, opts)
+		if err != nil {
+			result.Err = err
+
+			if ctx.Err() != nil {
+				break
+			}
+
+			continue
+		}
+
+		samples = append(samples, s)
+	}
+
+	result.Samples = len(samples)
+
+	if len(samples) == 0 {
+		return result
+	}
+
+	connect := make([]time.Duration, len(samples))
+	handshake := make([]time.Duration, len(samples))
+	roundTrip := make([]time.Duration, len(samples))
+
+	for i, s := range samples {
+		connect[i], handshake[i], roundTrip[i] = s.connect, s.tls, s.roundTrip
+	}
+
+	result.Connect = newProbeStats(connect)
+	result.TLS = newProbeStats(handshake)
+	result.RoundTrip = newProbeStats(roundTrip)
+
+	return result
+}
+
+// probeOnce measures a request over a new connection.
+func probeOnce(ctx context.Context, url string, opts ProbeOptions) (probeSample, error) {
+	var (
+		s        probeSample
+		tlsStart time.Time
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	transport := &http.Transport{
+		DisableKeepAlives: true,
+		TLSClientConfig:   opts.TLSConfig,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			start := time.Now()
+			conn, err := opts.DialContext(ctx, network, addr)
+			s.connect = time.Since(start)
+
+			return conn, err
+		},
+	}
+	defer transport.CloseIdleConnections()
+
+	trace := &httptrace.ClientTrace{
+		TLSHandshakeStart: func() { tlsStart = time.Now() },
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			s.tls = time.Since(tlsStart)
+		},
+	}
+
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), http.MethodGet, url, nil)
+	if err != nil {
+		return s, err
+	}
+
+	start := time.Now()
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return s, err
+	}
+
+	s.roundTrip = time.Since(start)
+
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	resp.Body.Close()
+
+	return s, nil
+}
+
+func newProbeStats(d []time.Duration) ProbeStats {
+	sorted := append([]time.Duration{}, d...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var sum time.Duration
+	for _, v := range sorted {
+		sum += v
+	}
+
+	median := sorted[len(sorted)/2]
+	if len(sorted)%2 == 0 {
+		median = (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+	}
+
+	return ProbeStats{
+		Min:    sorted[0],
+		Max:    sorted[len(sorted)-1],
+		Mean:   sum / time.Duration(len(sorted)),
+		Median: median,
+	}
+}
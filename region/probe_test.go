@@ -0,0 +1,79 @@
+package region
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProbe(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+
+	near := httptest.NewServer(handler)
+	defer near.Close()
+
+	far := httptest.NewServer(handler)
+	defer far.Close()
+
+	secure := httptest.NewTLSServer(handler)
+	defer secure.Close()
+
+	// The far region has 30ms of extra connect latency, the secure one 10ms.
+	latency := map[string]time.Duration{
+		strings.TrimPrefix(far.URL, "http://"):     30 * time.Millisecond,
+		strings.TrimPrefix(secure.URL, "https://"): 10 * time.Millisecond,
+	}
+
+	dialer := &net.Dialer{}
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		time.Sleep(latency[addr])
+
+		return dialer.DialContext(ctx, network, addr)
+	}
+
+	results := Probe(context.Background(), []Region{
+		{Name: "far", URL: far.URL},
+		{Name: "down", URL: "http://127.0.0.1:1"},
+		{Name: "secure", URL: secure.URL},
+		{Name: "near", URL: near.URL},
+	}, ProbeOptions{
+		Samples:     3,
+		DialContext: dial,
+		TLSConfig:   secure.Client().Transport.(*http.Transport).TLSClientConfig,
+	})
+
+	names := make([]string, len(results))
+	for i, r := range results {
+		names[i] = r.Region.Name
+	}
+
+	assert.Equal(t, []string{"near", "secure", "far", "down"}, names)
+
+	assert.Equal(t, 3, results[0].Samples)
+	assert.Zero(t, results[0].TLS.Median)
+	assert.Greater(t, results[1].TLS.Median, time.Duration(0))
+	assert.GreaterOrEqual(t, results[2].Connect.Min, 30*time.Millisecond)
+	assert.LessOrEqual(t, results[2].Connect.Min, results[2].Connect.Median)
+	assert.LessOrEqual(t, results[2].Connect.Median, results[2].Connect.Max)
+
+	assert.False(t, results[3].OK())
+	assert.Error(t, results[3].Err)
+
+	fastest, ok := Fastest(results)
+	assert.True(t, ok)
+	assert.Equal(t, "near", fastest.Name)
+}
+
+func TestNewProbeStats(t *testing.T) {
+	stats := newProbeStats([]time.Duration{4, 1, 3, 2})
+
+	assert.Equal(t, ProbeStats{Min: 1, Max: 4, Mean: 2, Median: 2}, stats)
+}
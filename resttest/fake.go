@@ -0,0 +1,428 @@
+// Package resttest provides a fake rest.API for tests.
+//
+// Usage:
+//
+//	fake := resttest.NewFake()
+//	fake.On("CreateTunnelV5", rest.TunnelStateWithMessages{TunnelState: rest.TunnelState{ID: "1"}}, nil)
+//	fake.Fail("ShutdownTunnel", errors.New("boom"))
+//
+//	runCodeUnderTest(fake)
+//
+//	fake.AssertCalled(t, "ShutdownTunnel", "1", "sigterm", false)
+package resttest
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	rest "github.com/saucelabs/tunnelrest-go"
+)
+
+// Fake must implement every method of rest.API.
+var _ rest.API = (*Fake)(nil)
+
+// T is the subset of testing.TB used by the assertion helpers.
+type T interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// Call is a recorded method call.
+type Call struct {
+	Method string
+	// Args are the call arguments, except the context.
+	Args []interface{}
+}
+
+// Fake is a rest.API recording calls, and returning scripted responses.
+// Methods without a scripted response return zero values. It's safe for
+// concurrent use.
+type Fake struct {
+	mu       sync.Mutex
+	calls    []Call
+	queued   map[string][][]interface{}
+	defaults map[string][]interface{}
+}
+
+// NewFake returns a Fake without scripted responses.
+func NewFake() *Fake {
+	return &Fake{
+		queued:   make(map[string][][]interface{}),
+		defaults: make(map[string][]interface{}),
+	}
+}
+
+// On queues the results of the next call of `method`, e.g.
+// On("TunnelState", rest.TunnelState{ID: "1"}, nil). Queued results are
+// returned once, in order. Walk methods are scripted with the walked states,
+// and the error. It panics if `method` isn't a rest.API method.
+func (f *Fake) On(method string, results ...interface{}) *Fake {
+	checkResults(method, results)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.init()
+	f.queued[method] = append(f.queued[method], results)
+
+	return f
+}
+
+// Always sets the results of the calls of `method` once the queued results
+// are exhausted.
+func (f *Fake) Always(method string, results ...interface{}) *Fake {
+	checkResults(method, results)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.init()
+	f.defaults[method] = results
+
+	return f
+}
+
+// Fail makes every call of `method` fail with `err`, and zero values. It
+// panics if `method` doesn't return an error, e.g. Heartbeat.
+func (f *Fake) Fail(method string, err error) *Fake {
+	types := scriptedTypes(method)
+	if len(types) == 0 || types[len(types)-1] != errorType {
+		panic(fmt.Sprintf("resttest: %s doesn't return an error, it can't fail", method))
+	}
+
+	results := make([]interface{}, len(types))
+	results[len(results)-1] = err
+
+	return f.Always(method, results...)
+}
+
+// Calls returns the recorded calls of `method`, or all the calls if `method`
+// is empty.
+func (f *Fake) Calls(method string) []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var calls []Call
+
+	for _, c := range f.calls {
+		if method == "" || c.Method == method {
+			calls = append(calls, c)
+		}
+	}
+
+	return calls
+}
+
+// Reset forgets the recorded calls and the scripted responses.
+func (f *Fake) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls = nil
+	f.queued = make(map[string][][]interface{})
+	f.defaults = make(map[string][]interface{})
+}
+
+// AssertCalled checks that `method` was called. If `args` are given, a call
+// must have arguments starting with `args`, the context excluded.
+func (f *Fake) AssertCalled(t T, method string, args ...interface{}) bool {
+	t.Helper()
+
+	calls := f.Calls(method)
+
+	for _, c := range calls {
+		if len(args) == 0 || len(c.Args) >= len(args) && reflect.DeepEqual(c.Args[:len(args)], args) {
+			return true
+		}
+	}
+
+	if len(calls) == 0 {
+		t.Errorf("%s was not called", method)
+	} else {
+		t.Errorf("%s was not called with %v, calls: %v", method, args, calls)
+	}
+
+	return false
+}
+
+// AssertNotCalled checks that `method` was not called.
+func (f *Fake) AssertNotCalled(t T, method string) bool {
+	t.Helper()
+
+	if calls := f.Calls(method); len(calls) > 0 {
+		t.Errorf("%s was called %d time(s): %v", method, len(calls), calls)
+
+		return false
+	}
+
+	return true
+}
+
+// AssertCallCount checks that `method` was called `n` times.
+func (f *Fake) AssertCallCount(t T, method string, n int) bool {
+	t.Helper()
+
+	if got := len(f.Calls(method)); got != n {
+		t.Errorf("%s was called %d time(s), expected %d", method, got, n)
+
+		return false
+	}
+
+	return true
+}
+
+func (f *Fake) init() {
+	if f.queued == nil {
+		f.queued = make(map[string][][]interface{})
+		f.defaults = make(map[string][]interface{})
+	}
+}
+
+// call records the call, and returns its scripted results, if any.
+func (f *Fake) call(method string, args ...interface{}) []interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.init()
+	f.calls = append(f.calls, Call{Method: method, Args: args})
+
+	if q := f.queued[method]; len(q) > 0 {
+		f.queued[method] = q[1:]
+
+		return q[0]
+	}
+
+	return f.defaults[method]
+}
+
+var (
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+	statesType = reflect.TypeOf([]rest.TunnelState(nil))
+
+	// walkedTypes are the scripted results of the Walk methods: the walked
+	// tunnel states, and the error.
+	walkedTypes = map[string][]reflect.Type{
+		"WalkTunnelStates":       {statesType, errorType},
+		"WalkSharedTunnelStates": {reflect.TypeOf(map[string][]rest.TunnelState(nil)), errorType},
+		"WalkAllTunnelStates":    {statesType, errorType},
+	}
+)
+
+// scriptedTypes returns the types of the scripted results of `method`, i.e.
+// its results, except for the Walk methods.
+func scriptedTypes(method string) []reflect.Type {
+	m, ok := reflect.TypeOf((*rest.API)(nil)).Elem().MethodByName(method)
+	if !ok {
+		panic(fmt.Sprintf("resttest: %q is not a rest.API method", method))
+	}
+
+	if types, ok := walkedTypes[method]; ok {
+		return types
+	}
+
+	types := make([]reflect.Type, m.Type.NumOut())
+	for i := range types {
+		types[i] = m.Type.Out(i)
+	}
+
+	return types
+}
+
+// checkResults panics if `results` don't match the scripted results of
+// `method`.
+func checkResults(method string, results []interface{}) {
+	types := scriptedTypes(method)
+
+	if len(results) != len(types) {
+		panic(fmt.Sprintf("resttest: %s is scripted with %d value(s), got %d", method, len(types), len(results)))
+	}
+
+	for i, r := range results {
+		if r == nil {
+			continue
+		}
+
+		if want := types[i]; !reflect.TypeOf(r).AssignableTo(want) {
+			panic(fmt.Sprintf("resttest: %s result %d must be %s, got %T", method, i, want, r))
+		}
+	}
+}
+
+// result returns the scripted value of type V, or its zero value.
+func result[V any](results []interface{}, i int) V {
+	var v V
+
+	if i < len(results) && results[i] != nil {
+		v = results[i].(V)
+	}
+
+	return v
+}
+
+func results2[V any](results []interface{}) (V, error) {
+	return result[V](results, 0), result[error](results, 1)
+}
+
+// CreateTunnelV4 implements rest.API.
+func (f *Fake) CreateTunnelV4(
+	_ context.Context, req *rest.CreateTunnelRequestV4, timeout time.Duration,
+) (rest.TunnelStateWithMessages, error) {
+	return results2[rest.TunnelStateWithMessages](f.call("CreateTunnelV4", req, timeout))
+}
+
+// CreateTunnelV5 implements rest.API.
+func (f *Fake) CreateTunnelV5(
+	_ context.Context, req *rest.CreateTunnelRequestV5, timeout time.Duration,
+) (rest.TunnelStateWithMessages, error) {
+	return results2[rest.TunnelStateWithMessages](f.call("CreateTunnelV5", req, timeout))
+}
+
+// CreateVPNProxy implements rest.API.
+func (f *Fake) CreateVPNProxy(
+	_ context.Context, req *rest.CreateTunnelRequestV4, timeout time.Duration,
+) (rest.TunnelStateWithMessages, error) {
+	return results2[rest.TunnelStateWithMessages](f.call("CreateVPNProxy", req, timeout))
+}
+
+// TunnelState implements rest.API.
+func (f *Fake) TunnelState(_ context.Context, id string) (rest.TunnelState, error) {
+	return results2[rest.TunnelState](f.call("TunnelState", id))
+}
+
+// ListTunnels implements rest.API.
+func (f *Fake) ListTunnels(protocol ...rest.Protocol) ([]string, error) {
+	return results2[[]string](f.call("ListTunnels", protocol))
+}
+
+// ListTunnelStates implements rest.API.
+func (f *Fake) ListTunnelStates(protocol ...rest.Protocol) ([]rest.TunnelState, error) {
+	return results2[[]rest.TunnelState](f.call("ListTunnelStates", protocol))
+}
+
+// ListSharedTunnels implements rest.API.
+func (f *Fake) ListSharedTunnels(protocol ...rest.Protocol) (map[string][]string, error) {
+	return results2[map[string][]string](f.call("ListSharedTunnels", protocol))
+}
+
+// ListSharedTunnelStates implements rest.API.
+func (f *Fake) ListSharedTunnelStates(protocol ...rest.Protocol) (map[string][]rest.TunnelState, error) {
+	return results2[map[string][]rest.TunnelState](f.call("ListSharedTunnelStates", protocol))
+}
+
+// ListAllTunnelStates implements rest.API.
+func (f *Fake) ListAllTunnelStates(limit int) ([]rest.TunnelState, error) {
+	return results2[[]rest.TunnelState](f.call("ListAllTunnelStates", limit))
+}
+
+// ListVPNProxies implements rest.API.
+func (f *Fake) ListVPNProxies() ([]string, error) {
+	return results2[[]string](f.call("ListVPNProxies"))
+}
+
+// ListVPNStates implements rest.API.
+func (f *Fake) ListVPNStates() ([]rest.TunnelState, error) {
+	return results2[[]rest.TunnelState](f.call("ListVPNStates"))
+}
+
+// ListSharedVPNs implements rest.API.
+func (f *Fake) ListSharedVPNs() (map[string][]string, error) {
+	return results2[map[string][]string](f.call("ListSharedVPNs"))
+}
+
+// ListSharedVPNStates implements rest.API.
+func (f *Fake) ListSharedVPNStates() (map[string][]rest.TunnelState, error) {
+	return results2[map[string][]rest.TunnelState](f.call("ListSharedVPNStates"))
+}
+
+// WalkTunnelStates implements rest.API. `fn` is called for each tunnel of
+// the scripted rest.TunnelState slice.
+func (f *Fake) WalkTunnelStates(_ context.Context, fn func(rest.TunnelState) error, protocol ...rest.Protocol) error {
+	results := f.call("WalkTunnelStates", protocol)
+
+	for _, s := range result[[]rest.TunnelState](results, 0) {
+		if err := fn(s); err != nil {
+			return err
+		}
+	}
+
+	return result[error](results, 1)
+}
+
+// WalkSharedTunnelStates implements rest.API. `fn` is called for each tunnel
+// of the scripted map of rest.TunnelState slices per owner, in random order.
+func (f *Fake) WalkSharedTunnelStates(
+	_ context.Context, fn func(owner string, state rest.TunnelState) error, protocol ...rest.Protocol,
+) error {
+	results := f.call("WalkSharedTunnelStates", protocol)
+
+	for owner, states := range result[map[string][]rest.TunnelState](results, 0) {
+		for _, s := range states {
+			if err := fn(owner, s); err != nil {
+				return err
+			}
+		}
+	}
+
+	return result[error](results, 1)
+}
+
+// WalkAllTunnelStates implements rest.API, see WalkTunnelStates.
+func (f *Fake) WalkAllTunnelStates(_ context.Context, limit int, fn func(rest.TunnelState) error) error {
+	results := f.call("WalkAllTunnelStates", limit)
+
+	for _, s := range result[[]rest.TunnelState](results, 0) {
+		if err := fn(s); err != nil {
+			return err
+		}
+	}
+
+	return result[error](results, 1)
+}
+
+// ShutdownTunnel implements rest.API.
+func (f *Fake) ShutdownTunnel(_ context.Context, id string, reason string, wait bool) (int, error) {
+	return results2[int](f.call("ShutdownTunnel", id, reason, wait))
+}
+
+// ShutdownVPNProxy implements rest.API.
+func (f *Fake) ShutdownVPNProxy(_ context.Context, id string, reason string, wait bool) (int, error) {
+	return results2[int](f.call("ShutdownVPNProxy", id, reason, wait))
+}
+
+// GetSCUpdates implements rest.API.
+func (f *Fake) GetSCUpdates(
+	_ context.Context, platform, version, configuration, region, tunnelName string, isTunnelPool bool,
+) (rest.SCUpdates, error) {
+	return results2[rest.SCUpdates](f.call("GetSCUpdates",
+		platform, version, configuration, region, tunnelName, isTunnelPool))
+}
+
+// GetVersions implements rest.API.
+func (f *Fake) GetVersions(platform, version string, all bool) (rest.SCVersions, error) {
+	return results2[rest.SCVersions](f.call("GetVersions", platform, version, all))
+}
+
+// UpdateClientStatus implements rest.API.
+func (f *Fake) UpdateClientStatus(
+	_ context.Context, id string, connected bool, duration time.Duration, memory *rest.Memory,
+) (rest.UpdateClientStatusResponse, error) {
+	return results2[rest.UpdateClientStatusResponse](f.call("UpdateClientStatus", id, connected, duration, memory))
+}
+
+// ReportCrash implements rest.API.
+func (f *Fake) ReportCrash(tunnel, info, logs string) error {
+	return result[error](f.call("ReportCrash", tunnel, info, logs), 0)
+}
+
+// Reattach implements rest.API.
+func (f *Fake) Reattach(_ context.Context, resume bool) ([]rest.ReattachResult, error) {
+	return results2[[]rest.ReattachResult](f.call("Reattach", resume))
+}
+
+// Heartbeat implements rest.API. It returns right away.
+func (f *Fake) Heartbeat(_ context.Context, id string, interval time.Duration, _ func(error)) {
+	f.call("Heartbeat", id, interval)
+}
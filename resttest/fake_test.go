@@ -0,0 +1,133 @@
+package resttest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	rest "github.com/saucelabs/tunnelrest-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// recorder is a T recording the assertion failures.
+type recorder struct {
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestFakeScriptedResponses(t *testing.T) {
+	ctx := context.Background()
+	fake := NewFake()
+
+	fake.On("TunnelState", rest.TunnelState{ID: "1"}, nil).
+		On("TunnelState", rest.TunnelState{}, errors.New("boom")).
+		Always("TunnelState", rest.TunnelState{ID: "default"}, nil)
+
+	s, err := fake.TunnelState(ctx, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, "1", s.ID)
+
+	_, err = fake.TunnelState(ctx, "1")
+	assert.EqualError(t, err, "boom")
+
+	for i := 0; i < 2; i++ {
+		s, err = fake.TunnelState(ctx, "1")
+		assert.NoError(t, err)
+		assert.Equal(t, "default", s.ID)
+	}
+}
+
+func TestFakeZeroValues(t *testing.T) {
+	fake := NewFake()
+
+	ids, err := fake.ListTunnels()
+	assert.NoError(t, err)
+	assert.Nil(t, ids)
+
+	assert.NoError(t, fake.ReportCrash("1", "info", "logs"))
+}
+
+func TestFakeFail(t *testing.T) {
+	fake := NewFake().Fail("ShutdownTunnel", errors.New("boom"))
+
+	jobs, err := fake.ShutdownTunnel(context.Background(), "1", "sigterm", false)
+	assert.EqualError(t, err, "boom")
+	assert.Zero(t, jobs)
+
+	fake.Fail("ReportCrash", errors.New("crash"))
+	assert.EqualError(t, fake.ReportCrash("1", "", ""), "crash")
+}
+
+func TestFakeScriptPanics(t *testing.T) {
+	fake := NewFake()
+
+	assert.Panics(t, func() { fake.On("NoSuchMethod", nil) })
+	assert.Panics(t, func() { fake.On("TunnelState", rest.TunnelState{}) })
+	assert.Panics(t, func() { fake.On("TunnelState", "1", nil) })
+	assert.PanicsWithValue(t, "resttest: Heartbeat doesn't return an error, it can't fail", func() {
+		fake.Fail("Heartbeat", errors.New("boom"))
+	})
+}
+
+func TestFakeAssertions(t *testing.T) {
+	ctx := context.Background()
+	fake := NewFake()
+
+	_, _ = fake.ShutdownTunnel(ctx, "1", "sigterm", false)
+	_, _ = fake.ShutdownTunnel(ctx, "2", "sigterm", true)
+	_, _ = fake.ListTunnelStates(rest.Protocol("h2c"))
+
+	assert.True(t, fake.AssertCalled(t, "ShutdownTunnel"))
+	assert.True(t, fake.AssertCalled(t, "ShutdownTunnel", "2"))
+	assert.True(t, fake.AssertCalled(t, "ShutdownTunnel", "1", "sigterm", false))
+	assert.True(t, fake.AssertCallCount(t, "ShutdownTunnel", 2))
+	assert.True(t, fake.AssertNotCalled(t, "CreateTunnelV5"))
+	assert.True(t, fake.AssertCalled(t, "ListTunnelStates", []rest.Protocol{rest.Protocol("h2c")}))
+	assert.Len(t, fake.Calls(""), 3)
+
+	r := &recorder{}
+	assert.False(t, fake.AssertCalled(r, "ShutdownTunnel", "3"))
+	assert.False(t, fake.AssertCalled(r, "TunnelState"))
+	assert.False(t, fake.AssertNotCalled(r, "ShutdownTunnel"))
+	assert.False(t, fake.AssertCallCount(r, "ShutdownTunnel", 1))
+	assert.Len(t, r.errors, 4)
+
+	fake.Reset()
+	assert.Empty(t, fake.Calls(""))
+}
+
+func TestFakeZeroValue(t *testing.T) {
+	var fake Fake
+
+	fake.On("ListVPNProxies", []string{"1"}, nil)
+
+	ids, err := fake.ListVPNProxies()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1"}, ids)
+}
+
+func TestFakeWalk(t *testing.T) {
+	ctx := context.Background()
+	fake := NewFake()
+
+	fake.On("WalkTunnelStates", []rest.TunnelState{{ID: "1"}, {ID: "2"}}, nil)
+
+	var ids []string
+
+	err := fake.WalkTunnelStates(ctx, func(s rest.TunnelState) error {
+		ids = append(ids, s.ID)
+
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1", "2"}, ids)
+
+	fake.Fail("WalkAllTunnelStates", errors.New("boom"))
+	assert.EqualError(t, fake.WalkAllTunnelStates(ctx, 0, nil), "boom")
+}
@@ -0,0 +1,387 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/saucelabs/tunnelrest-go/region"
+)
+
+const (
+	// OrphanShutdownReason is sent when Reattach shuts down a tunnel left
+	// running by a previous process.
+	OrphanShutdownReason = "orphaned"
+
+	defaultSessionLockTimeout = 5 * time.Second
+	sessionStaleLockAge       = 30 * time.Second
+	sessionLockRetryInterval  = 10 * time.Millisecond
+)
+
+// ErrSessionLocked is returned when the session lock can't be acquired.
+var ErrSessionLocked = errors.New("session state file is locked by another process")
+
+// Session is the persisted state of a created tunnel.
+type Session struct {
+	TunnelID         string `json:"tunnel_id"`
+	TunnelIdentifier string `json:"tunnel_identifier,omitempty"`
+	// Region is the name of the region the tunnel runs in, if known.
+	Region  string    `json:"region,omitempty"`
+	BaseURL string    `json:"base_url"`
+	Created time.Time `json:"created"`
+	// PID of the process that created the tunnel.
+	PID int `json:"pid"`
+}
+
+// SessionStore persists the sessions of the created tunnels to a state file,
+// keyed by tunnel ID. Writes are atomic, and serialized across processes with
+// a lock file next to the state file.
+type SessionStore struct {
+	// Path of the state file.
+	Path string
+	// LockTimeout is how long to wait for the lock. Defaults to 5s.
+	LockTimeout time.Duration
+}
+
+// Load returns the persisted sessions, oldest first.
+func (s *SessionStore) Load() ([]Session, error) {
+	data, err := os.ReadFile(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []Session
+
+	// State files of a single session are still read.
+	if data = bytes.TrimSpace(data); len(data) > 0 && data[0] == '{' {
+		sessions = make([]Session, 1)
+		err = json.Unmarshal(data, &sessions[0])
+	} else {
+		err = json.Unmarshal(data, &sessions)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid session state file %s: %w", s.Path, err)
+	}
+
+	return sessions, nil
+}
+
+// Save persists `session`, replacing the session of the same tunnel, if any.
+func (s *SessionStore) Save(session Session) error {
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	sessions, err := s.Load()
+	if err != nil {
+		return err
+	}
+
+	replaced := false
+
+	for i := range sessions {
+		if sessions[i].TunnelID == session.TunnelID {
+			sessions[i] = session
+			replaced = true
+		}
+	}
+
+	if !replaced {
+		sessions = append(sessions, session)
+	}
+
+	return s.write(sessions)
+}
+
+// Remove removes the persisted session of tunnel `id`, or all the sessions if
+// `id` is empty.
+func (s *SessionStore) Remove(id string) error {
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	var kept []Session
+
+	if id != "" {
+		sessions, err := s.Load()
+		if err != nil {
+			return err
+		}
+
+		for _, session := range sessions {
+			if session.TunnelID != id {
+				kept = append(kept, session)
+			}
+		}
+
+		if len(kept) == len(sessions) {
+			return nil
+		}
+	}
+
+	if len(kept) > 0 {
+		return s.write(kept)
+	}
+
+	if err := os.Remove(s.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// write replaces the state file atomically, the lock must be held.
+func (s *SessionStore) write(sessions []Session) error {
+	data, err := json.MarshalIndent(sessions, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(s.Path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(dir, filepath.Base(s.Path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	tmp := f.Name()
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmp)
+
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+
+		return err
+	}
+
+	return os.Rename(tmp, s.Path)
+}
+
+// lock acquires the lock file. Locks older than 30s are considered left over
+// by a dead process, and broken.
+func (s *SessionStore) lock() (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0o700); err != nil {
+		return nil, err
+	}
+
+	timeout := s.LockTimeout
+	if timeout <= 0 {
+		timeout = defaultSessionLockTimeout
+	}
+
+	lockPath := s.Path + ".lock"
+	deadline := time.Now().Add(timeout)
+
+	for {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err == nil {
+			_, _ = fmt.Fprintf(f, "%d\n", os.Getpid())
+			f.Close()
+
+			return func() { _ = os.Remove(lockPath) }, nil
+		}
+
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+
+		if fi, err := os.Stat(lockPath); err == nil && time.Since(fi.ModTime()) > sessionStaleLockAge {
+			_ = os.Remove(lockPath)
+
+			continue
+		}
+
+		if time.Now().After(deadline) {
+			return nil, ErrSessionLocked
+		}
+
+		time.Sleep(sessionLockRetryInterval)
+	}
+}
+
+// saveSession persists the session of the created `tunnel`, if the client
+// has a SessionStore.
+func (c *Client) saveSession(tunnel TunnelState) error {
+	if c.SessionStore == nil {
+		return nil
+	}
+
+	session := Session{
+		TunnelID:         tunnel.ID,
+		TunnelIdentifier: tunnel.TunnelIdentifier,
+		BaseURL:          c.BaseURL,
+		Created:          time.Now().UTC(),
+		PID:              os.Getpid(),
+	}
+
+	for _, r := range region.Known {
+		if strings.TrimRight(r.URL, "/") == strings.TrimRight(c.BaseURL, "/") {
+			session.Region = r.Name
+		}
+	}
+
+	return c.SessionStore.Save(session)
+}
+
+// ReattachAction is what Reattach did with a persisted session.
+type ReattachAction int
+
+const (
+	// ReattachGone means the tunnel was already shut down.
+	ReattachGone ReattachAction = iota + 1
+	// ReattachResumed means the tunnel is running, and the caller should
+	// resume heartbeating, see Heartbeat.
+	ReattachResumed
+	// ReattachShutdown means the orphaned tunnel was shut down.
+	ReattachShutdown
+)
+
+// String interface implementation.
+func (a ReattachAction) String() string {
+	switch a {
+	case ReattachGone:
+		return "gone"
+	case ReattachResumed:
+		return "resumed"
+	case ReattachShutdown:
+		return "shutdown"
+	default:
+		return fmt.Sprintf("ReattachAction(%d)", int(a))
+	}
+}
+
+// ReattachResult is the result of Reattach for a persisted session.
+type ReattachResult struct {
+	Action ReattachAction
+	// Session is the persisted session.
+	Session Session
+	// State is the latest tunnel state, if the tunnel still exists.
+	State TunnelState
+	// Err is the error of checking or shutting down the tunnel, the session
+	// is then kept.
+	Err error
+}
+
+// Reattach reads the sessions persisted by the client SessionStore, and
+// checks the state of their tunnels, in the region of the session. A running
+// tunnel is resumed if `resume` is set, otherwise it's shut down with
+// OrphanShutdownReason. Sessions are removed unless the tunnel is resumed, or
+// the check failed. The first error of the results is returned.
+func (c *Client) Reattach(ctx context.Context, resume bool) ([]ReattachResult, error) {
+	if c.SessionStore == nil {
+		return nil, nil
+	}
+
+	sessions, err := c.SessionStore.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]ReattachResult, 0, len(sessions))
+
+	var firstErr error
+
+	for _, session := range sessions {
+		result := c.reattach(ctx, session, resume)
+
+		if result.Err == nil && result.Action != ReattachResumed {
+			result.Err = c.SessionStore.Remove(session.TunnelID)
+		}
+
+		if result.Err != nil && firstErr == nil {
+			firstErr = result.Err
+		}
+
+		results = append(results, result)
+	}
+
+	return results, firstErr
+}
+
+// reattach checks the tunnel of `session` with a client of the session
+// BaseURL, the tunnel may run in another region than the client one.
+func (c *Client) reattach(ctx context.Context, session Session, resume bool) ReattachResult {
+	result := ReattachResult{Session: session}
+
+	sc := *c
+	if session.BaseURL != "" {
+		sc.BaseURL = session.BaseURL
+	}
+
+	state, err := sc.TunnelState(ctx, session.TunnelID)
+
+	switch {
+	case isNotFound(err):
+		result.Action = ReattachGone
+	case err != nil:
+		result.Err = err
+	case isTerminated(state):
+		result.Action, result.State = ReattachGone, state
+	case resume:
+		result.Action, result.State = ReattachResumed, state
+	default:
+		result.State = state
+
+		if _, err := sc.shutdown(ctx, session.TunnelID, OrphanShutdownReason, false); err != nil {
+			result.Err = err
+		} else {
+			result.Action = ReattachShutdown
+		}
+	}
+
+	return result
+}
+
+// Heartbeat reports the tunnel `id` as connected every `interval` until `ctx`
+// is done, e.g. after the tunnel is resumed by Reattach. Errors are passed to
+// `onError`, if set.
+func (c *Client) Heartbeat(ctx context.Context, id string, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	start := time.Now()
+
+	for {
+		memory, _ := CollectMemory()
+
+		if _, err := c.UpdateClientStatus(ctx, id, true, time.Since(start), memory); err != nil && ctx.Err() == nil && onError != nil {
+			onError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
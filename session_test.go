@@ -0,0 +1,248 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	assertLib "github.com/stretchr/testify/assert"
+)
+
+func TestSessionStore(t *testing.T) {
+	assert := assertLib.New(t)
+
+	store := &SessionStore{Path: filepath.Join(t.TempDir(), "state", "session.json")}
+
+	sessions, err := store.Load()
+	assert.NoError(err)
+	assert.Empty(sessions)
+
+	// Concurrent writers don't corrupt the state file, or lose sessions.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+			assert.NoError(store.Save(Session{TunnelID: fmt.Sprintf("t%d", i%2), PID: i}))
+		}(i)
+	}
+	wg.Wait()
+
+	sessions, err = store.Load()
+	assert.NoError(err)
+	assert.Len(sessions, 2)
+
+	// Sessions of other tunnels are kept.
+	assert.NoError(store.Remove("t2"))
+	sessions, _ = store.Load()
+	assert.Len(sessions, 2)
+
+	assert.NoError(store.Remove("t1"))
+	sessions, _ = store.Load()
+	assert.Len(sessions, 1)
+	assert.Equal("t0", sessions[0].TunnelID)
+
+	assert.NoError(store.Remove("t0"))
+	sessions, _ = store.Load()
+	assert.Empty(sessions)
+
+	matches, _ := filepath.Glob(filepath.Join(filepath.Dir(store.Path), "*"))
+	assert.Empty(matches)
+}
+
+func TestSessionStoreLock(t *testing.T) {
+	assert := assertLib.New(t)
+
+	store := &SessionStore{Path: filepath.Join(t.TempDir(), "session.json"), LockTimeout: 20 * time.Millisecond}
+
+	assert.NoError(os.WriteFile(store.Path+".lock", []byte("1\n"), 0o600))
+	assert.ErrorIs(store.Save(Session{TunnelID: "t1"}), ErrSessionLocked)
+
+	// Stale locks are broken.
+	old := time.Now().Add(-time.Minute)
+	assert.NoError(os.Chtimes(store.Path+".lock", old, old))
+	assert.NoError(store.Save(Session{TunnelID: "t1"}))
+}
+
+func TestClientSession(t *testing.T) {
+	assert := assertLib.New(t)
+
+	api, server := newFakeTunnelAPI()
+	defer server.Close()
+
+	store := &SessionStore{Path: filepath.Join(t.TempDir(), "session.json")}
+	c := &Client{BaseURL: server.URL, User: tunnelUser, SessionStore: store}
+
+	tunnel, err := c.CreateTunnelV5(context.Background(), &CreateTunnelRequestV5{TunnelIdentifier: "app"}, time.Second)
+	assert.NoError(err)
+
+	sessions, err := store.Load()
+	assert.NoError(err)
+	assert.Len(sessions, 1)
+
+	session := sessions[0]
+	assert.Equal(tunnel.ID, session.TunnelID)
+	assert.Equal("app", session.TunnelIdentifier)
+	assert.Equal(server.URL, session.BaseURL)
+	assert.Equal(os.Getpid(), session.PID)
+
+	// After a restart, the tunnel is resumed.
+	c = &Client{BaseURL: server.URL, User: tunnelUser, SessionStore: store}
+
+	results, err := c.Reattach(context.Background(), true)
+	assert.NoError(err)
+	assert.Len(results, 1)
+	assert.Equal(ReattachResumed, results[0].Action)
+	assert.Equal(tunnel.ID, results[0].State.ID)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go c.Heartbeat(ctx, tunnel.ID, time.Millisecond, func(err error) { t.Error(err) })
+
+	assert.Eventually(func() bool {
+		api.mu.Lock()
+		defer api.mu.Unlock()
+
+		return api.heartbeats[tunnel.ID] >= 2
+	}, time.Second, time.Millisecond)
+	cancel()
+
+	// Or shut down as an orphan.
+	results, err = c.Reattach(context.Background(), false)
+	assert.NoError(err)
+	assert.Len(results, 1)
+	assert.Equal(ReattachShutdown, results[0].Action)
+
+	state, _ := c.TunnelState(context.Background(), tunnel.ID)
+	assert.Equal(OrphanShutdownReason, state.ShutdownReason)
+
+	sessions, _ = store.Load()
+	assert.Empty(sessions)
+
+	results, err = c.Reattach(context.Background(), false)
+	assert.NoError(err)
+	assert.Empty(results)
+}
+
+func TestClientSessionRegions(t *testing.T) {
+	assert := assertLib.New(t)
+
+	usAPI, usServer := newFakeTunnelAPI()
+	defer usServer.Close()
+
+	euAPI, euServer := newFakeTunnelAPI()
+	defer euServer.Close()
+
+	store := &SessionStore{Path: filepath.Join(t.TempDir(), "session.json")}
+
+	us := &Client{BaseURL: usServer.URL, User: tunnelUser, SessionStore: store}
+	_, err := us.CreateTunnelV5(context.Background(), &CreateTunnelRequestV5{TunnelIdentifier: "us"}, time.Second)
+	assert.NoError(err)
+
+	eu := &Client{BaseURL: euServer.URL, User: tunnelUser, SessionStore: store}
+	_, err = eu.CreateTunnelV5(context.Background(), &CreateTunnelRequestV5{TunnelIdentifier: "eu"}, time.Second)
+	assert.NoError(err)
+
+	// Both tunnels are found in their region, whatever the client region.
+	results, err := us.Reattach(context.Background(), false)
+	assert.NoError(err)
+	assert.Len(results, 2)
+
+	for _, r := range results {
+		assert.Equal(ReattachShutdown, r.Action, r.Session.TunnelIdentifier)
+	}
+
+	assert.Equal(0, usAPI.running())
+	assert.Equal(0, euAPI.running())
+
+	sessions, _ := store.Load()
+	assert.Empty(sessions)
+}
+
+func TestSessionStoreSingleSessionFile(t *testing.T) {
+	assert := assertLib.New(t)
+
+	store := &SessionStore{Path: filepath.Join(t.TempDir(), "session.json")}
+	assert.NoError(os.WriteFile(store.Path, []byte(`{"tunnel_id": "t1", "base_url": "http://localhost"}`), 0o600))
+
+	sessions, err := store.Load()
+	assert.NoError(err)
+	assert.Equal([]Session{{TunnelID: "t1", BaseURL: "http://localhost"}}, sessions)
+}
+
+func TestClientSessionGone(t *testing.T) {
+	assert := assertLib.New(t)
+
+	_, server := newFakeTunnelAPI()
+	defer server.Close()
+
+	store := &SessionStore{Path: filepath.Join(t.TempDir(), "session.json")}
+	assert.NoError(store.Save(Session{TunnelID: "missing"}))
+
+	c := &Client{BaseURL: server.URL, User: tunnelUser, SessionStore: store}
+
+	results, err := c.Reattach(context.Background(), true)
+	assert.NoError(err)
+	assert.Len(results, 1)
+	assert.Equal(ReattachGone, results[0].Action)
+
+	sessions, _ := store.Load()
+	assert.Empty(sessions)
+}
+
+func TestClientShutdownRemovesSession(t *testing.T) {
+	assert := assertLib.New(t)
+
+	_, server := newFakeTunnelAPI()
+	defer server.Close()
+
+	store := &SessionStore{Path: filepath.Join(t.TempDir(), "session.json")}
+	c := &Client{BaseURL: server.URL, User: tunnelUser, SessionStore: store}
+
+	tunnel, err := c.CreateTunnelV5(context.Background(), &CreateTunnelRequestV5{}, time.Second)
+	assert.NoError(err)
+
+	_, err = c.ShutdownTunnel(context.Background(), tunnel.ID, "sigterm", false)
+	assert.NoError(err)
+
+	sessions, _ := store.Load()
+	assert.Empty(sessions)
+}
+
+func TestClientSessionLockedFatalMessage(t *testing.T) {
+	assert := assertLib.New(t)
+
+	api, _ := newFakeTunnelAPI()
+	server := httptest.NewServer(fatalOnCreate(api))
+	defer server.Close()
+
+	store := &SessionStore{Path: filepath.Join(t.TempDir(), "session.json"), LockTimeout: 20 * time.Millisecond}
+	assert.NoError(os.WriteFile(store.Path+".lock", []byte("1\n"), 0o600))
+
+	var handled []Message
+
+	c := &Client{
+		BaseURL:        server.URL,
+		User:           tunnelUser,
+		SessionStore:   store,
+		MessageHandler: MessageHandlerFunc(func(m Message) { handled = append(handled, m) }),
+	}
+
+	// The fatal message is handled although the session can't be saved.
+	tunnel, err := c.CreateTunnelV5(context.Background(), &CreateTunnelRequestV5{}, time.Second)
+	assert.ErrorIs(err, ErrSessionLocked)
+	assert.NotEmpty(tunnel.ID)
+	assert.Len(handled, 1)
+
+	c.FatalAsError = true
+
+	tunnel, err = c.CreateTunnelV5(context.Background(), &CreateTunnelRequestV5{}, time.Second)
+	var fatalErr *FatalMessageError
+	assert.ErrorAs(err, &fatalErr)
+	assert.NotEmpty(tunnel.ID)
+}
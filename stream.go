@@ -0,0 +1,196 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+)
+
+// responseDecoder is implemented by Operation responses decoding the response
+// body themselves, instead of the client DecodeJSON. `check`, if set, checks
+// the decoded values for drift.
+type responseDecoder interface {
+	decodeResponse(r io.Reader, check driftCheck) error
+}
+
+var tunnelStateType = reflect.TypeOf(TunnelState{})
+
+// tunnelStream decodes tunnel states one at a time, as the response is read.
+type tunnelStream struct {
+	// keyed streams decode an object of tunnel state arrays, e.g. per owner.
+	keyed bool
+	// only, if set, is the only key of a keyed stream that is decoded.
+	only string
+	fn   func(key string, state TunnelState) error
+	// err is the error returned by fn, if any.
+	err error
+
+	check driftCheck
+}
+
+func (s *tunnelStream) decodeResponse(r io.Reader, check driftCheck) error {
+	s.check = check
+
+	if err := s.decode(json.NewDecoder(r)); err != nil {
+		if s.err != nil {
+			return err
+		}
+
+		return fmt.Errorf("couldn't decode JSON document: %w", err)
+	}
+
+	return nil
+}
+
+func (s *tunnelStream) decode(dec *json.Decoder) error {
+	if !s.keyed {
+		return s.decodeArray(dec, "", "$")
+	}
+
+	if ok, err := expectDelim(dec, '{'); !ok || err != nil {
+		return err
+	}
+
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+
+		key, _ := tok.(string)
+
+		if s.only != "" && key != s.only {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if err := s.decodeArray(dec, key, fmt.Sprintf("$[%q]", key)); err != nil {
+			return err
+		}
+	}
+
+	_, err := dec.Token()
+
+	return err
+}
+
+func (s *tunnelStream) decodeArray(dec *json.Decoder, key, path string) error {
+	if ok, err := expectDelim(dec, '['); !ok || err != nil {
+		return err
+	}
+
+	for i := 0; dec.More(); i++ {
+		var state TunnelState
+		if err := s.decodeState(dec, &state, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+			return err
+		}
+
+		if err := s.fn(key, state); err != nil {
+			s.err = err
+
+			return err
+		}
+	}
+
+	_, err := dec.Token()
+
+	return err
+}
+
+func (s *tunnelStream) decodeState(dec *json.Decoder, state *TunnelState, path string) error {
+	if s.check == nil {
+		return dec.Decode(state)
+	}
+
+	var raw json.RawMessage
+	if err := dec.Decode(&raw); err != nil {
+		return err
+	}
+
+	if err := s.check(raw, tunnelStateType, path); err != nil {
+		return err
+	}
+
+	return json.Unmarshal(raw, state)
+}
+
+// expectDelim reads the opening delimiter `delim`. It returns false for null.
+func expectDelim(dec *json.Decoder, delim json.Delim) (bool, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return false, err
+	}
+
+	if tok == nil {
+		return false, nil
+	}
+
+	if d, ok := tok.(json.Delim); !ok || d != delim {
+		return false, fmt.Errorf("expected %s, got %v", delim, tok)
+	}
+
+	return true, nil
+}
+
+// walk streams the tunnel states of operation `op`. The error returned by
+// the callback, if any, is returned as is.
+func (c *Client) walk(ctx context.Context, op *Operation, stream *tunnelStream) error {
+	op.Method = http.MethodGet
+	op.Response = stream
+
+	err := c.invoke(ctx, op)
+	if stream.err != nil {
+		return stream.err
+	}
+
+	return err
+}
+
+// WalkTunnelStates calls `fn` for each tunnel of the user, as the response is
+// decoded, without holding all the tunnel states in memory. Walking stops at
+// the first error returned by `fn`, which is returned. The client DecodeJSON
+// isn't used. Filter results by one or more protocol, or leave empty for all
+// protocols.
+func (c *Client) WalkTunnelStates(ctx context.Context, fn func(TunnelState) error, protocol ...Protocol) error {
+	url := fmt.Sprintf("%s/%s/tunnels?full=1%s", c.BaseURL, c.getTunnelOwnerUsername(), protocolQuery(protocol))
+
+	return c.walk(ctx, &Operation{Name: OperationWalkTunnels, URL: url}, &tunnelStream{
+		fn: func(_ string, state TunnelState) error { return fn(state) },
+	})
+}
+
+// WalkSharedTunnelStates is WalkTunnelStates for the tunnels of the users of
+// the org with shared tunnels.
+func (c *Client) WalkSharedTunnelStates(
+	ctx context.Context, fn func(owner string, state TunnelState) error, protocol ...Protocol,
+) error {
+	url := fmt.Sprintf("%s/%s/tunnels?full=1&all=1%s", c.BaseURL, c.getTunnelOwnerUsername(), protocolQuery(protocol))
+
+	return c.walk(ctx, &Operation{Name: OperationWalkSharedTunnels, URL: url}, &tunnelStream{
+		keyed: true,
+		fn:    fn,
+	})
+}
+
+// WalkAllTunnelStates is WalkTunnelStates for all the tunnels of the user,
+// including not currently running, see ListAllTunnelStates.
+func (c *Client) WalkAllTunnelStates(ctx context.Context, limit int, fn func(TunnelState) error) error {
+	url := fmt.Sprintf("%s/%s/all_tunnels", c.BaseURL, c.getTunnelOwnerUsername())
+
+	if limit > 0 {
+		url = fmt.Sprintf("%s?limit=%d", url, limit)
+	}
+
+	return c.walk(ctx, &Operation{Name: OperationWalkAllTunnels, URL: url}, &tunnelStream{
+		keyed: true,
+		only:  "tunnels",
+		fn:    func(_ string, state TunnelState) error { return fn(state) },
+	})
+}
@@ -0,0 +1,236 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	assertLib "github.com/stretchr/testify/assert"
+)
+
+// generateTunnelsJSON returns a JSON array of `n` tunnel states.
+func generateTunnelsJSON(n int) string {
+	var b strings.Builder
+
+	b.WriteString("[")
+
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			b.WriteString(",")
+		}
+
+		fmt.Fprintf(&b, `{"id": "t%d", "owner": "%s", "status": "running", "tunnel_identifier": "pool-%d",`+
+			` "domain_names": ["sauce-connect.proxy"], "metadata": {"hostname": "host-%d"}}`, i, tunnelUser, i, i)
+	}
+
+	b.WriteString("]")
+
+	return b.String()
+}
+
+func jsonServer(body string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, body)
+	}))
+}
+
+func TestWalkTunnelStates(t *testing.T) {
+	assert := assertLib.New(t)
+
+	server := jsonServer(generateTunnelsJSON(3))
+	defer server.Close()
+
+	c := &Client{BaseURL: server.URL, User: tunnelUser}
+
+	var ids []string
+
+	err := c.WalkTunnelStates(context.Background(), func(s TunnelState) error {
+		ids = append(ids, s.ID)
+
+		return nil
+	})
+	assert.NoError(err)
+	assert.Equal([]string{"t0", "t1", "t2"}, ids)
+
+	stop := errors.New("stop")
+	ids = nil
+
+	err = c.WalkTunnelStates(context.Background(), func(s TunnelState) error {
+		ids = append(ids, s.ID)
+
+		return stop
+	})
+	assert.Equal(stop, err)
+	assert.Equal([]string{"t0"}, ids)
+}
+
+func TestWalkSharedAndAllTunnelStates(t *testing.T) {
+	assert := assertLib.New(t)
+
+	server := jsonServer(fmt.Sprintf(`{"alice": %s, "bob": [], "tunnels": %s, "carol": null}`,
+		generateTunnelsJSON(2), generateTunnelsJSON(1)))
+	defer server.Close()
+
+	c := &Client{BaseURL: server.URL, User: tunnelUser}
+
+	var shared []string
+
+	err := c.WalkSharedTunnelStates(context.Background(), func(owner string, s TunnelState) error {
+		shared = append(shared, owner+"/"+s.ID)
+
+		return nil
+	})
+	assert.NoError(err)
+	assert.Equal([]string{"alice/t0", "alice/t1", "tunnels/t0"}, shared)
+
+	var all []string
+
+	err = c.WalkAllTunnelStates(context.Background(), 10, func(s TunnelState) error {
+		all = append(all, s.ID)
+
+		return nil
+	})
+	assert.NoError(err)
+	assert.Equal([]string{"t0"}, all)
+}
+
+func TestWalkTunnelStatesInvalid(t *testing.T) {
+	for _, body := range []string{`{}`, `[{"id": 1}]`, `[{"id": "t0"}`} {
+		server := jsonServer(body)
+
+		c := &Client{BaseURL: server.URL, User: tunnelUser}
+
+		err := c.WalkTunnelStates(context.Background(), func(TunnelState) error { return nil })
+
+		var cE *ClientError
+		assertLib.Truef(t, errors.As(err, &cE), "%s: expected a *ClientError, got %v", body, err)
+
+		server.Close()
+	}
+}
+
+func TestMaxResponseSize(t *testing.T) {
+	assert := assertLib.New(t)
+
+	body := generateTunnelsJSON(100)
+
+	// Chunked responses have no Content-Length.
+	chunked := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < len(body); i += 512 {
+			end := i + 512
+			if end > len(body) {
+				end = len(body)
+			}
+
+			fmt.Fprint(w, body[i:end])
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer chunked.Close()
+
+	sized := jsonServer(body)
+	defer sized.Close()
+
+	for _, url := range []string{chunked.URL, sized.URL} {
+		c := &Client{BaseURL: url, User: tunnelUser, MaxResponseSize: int64(len(body))}
+
+		states, err := c.ListTunnelStates()
+		assert.NoError(err)
+		assert.Len(states, 100)
+
+		c.MaxResponseSize = int64(len(body) - 1)
+
+		_, err = c.ListTunnelStates()
+
+		var tooLarge *ResponseTooLargeError
+		assert.Truef(errors.As(err, &tooLarge), "expected a *ResponseTooLargeError, got %v", err)
+
+		err = c.WalkTunnelStates(context.Background(), func(TunnelState) error { return nil })
+		assert.Truef(errors.As(err, &tooLarge), "expected a *ResponseTooLargeError, got %v", err)
+	}
+}
+
+func TestMaxErrorBodySize(t *testing.T) {
+	assert := assertLib.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+		fmt.Fprint(w, strings.Repeat("x", 100))
+	}))
+	defer server.Close()
+
+	c := &Client{BaseURL: server.URL, User: tunnelUser}
+
+	_, err := c.TunnelState(context.Background(), "t0")
+
+	var cE *ClientError
+	assert.True(errors.As(err, &cE))
+	assert.Len(cE.ServerResponse, 100)
+	assert.False(cE.ServerResponseTruncated)
+
+	c.MaxErrorBodySize = 10
+
+	_, err = c.TunnelState(context.Background(), "t0")
+	assert.True(errors.As(err, &cE))
+	assert.Equal(http.StatusBadGateway, cE.StatusCode)
+	assert.Equal(strings.Repeat("x", 10), cE.ServerResponse)
+	assert.True(cE.ServerResponseTruncated)
+	assert.Contains(err.Error(), "(truncated)")
+}
+
+func BenchmarkListTunnelStates(b *testing.B) {
+	server := jsonServer(generateTunnelsJSON(5000))
+	defer server.Close()
+
+	c := &Client{BaseURL: server.URL, User: tunnelUser}
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		states, err := c.ListTunnelStates()
+		if err != nil || len(states) != 5000 {
+			b.Fatal(err, len(states))
+		}
+	}
+}
+
+func BenchmarkWalkTunnelStates(b *testing.B) {
+	known := generateTunnelsJSON(5000)
+	// Unknown fields are retained in TunnelState.Extra.
+	unknown := strings.ReplaceAll(known, `{"id":`, `{"labels": {"team": "qa"}, "weight": 1, "id":`)
+
+	for _, bm := range []struct {
+		name string
+		body string
+	}{
+		{"known fields", known},
+		{"unknown fields", unknown},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			server := jsonServer(bm.body)
+			defer server.Close()
+
+			c := &Client{BaseURL: server.URL, User: tunnelUser}
+
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				n := 0
+
+				err := c.WalkTunnelStates(context.Background(), func(TunnelState) error {
+					n++
+
+					return nil
+				})
+				if err != nil || n != 5000 {
+					b.Fatal(err, n)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,308 @@
+package util
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Mask replaces redacted secrets.
+const Mask = "****"
+
+// secretGroup is the name of the regexp group that is redacted. If a pattern
+// doesn't have such a group, the whole match is redacted.
+const secretGroup = "secret"
+
+var (
+	builtinPatterns = []namedPattern{
+		{
+			name: "basic-auth-url",
+			re:   regexp.MustCompile(`\w+://[^:/@\s]+:(?P<secret>[^@/\s]+)@`),
+		},
+		{
+			name: "bearer-token",
+			re:   regexp.MustCompile(`(?i)\bbearer\s+(?P<secret>[A-Za-z0-9\-._~+/]{16,}=*)`),
+		},
+		{
+			name: "basic-auth-header",
+			re:   regexp.MustCompile(`(?i)\bauthorization"?\s*[:=]\s*"?basic\s+(?P<secret>[A-Za-z0-9+/]+=*)`),
+		},
+		{
+			name: "key-value",
+			re: regexp.MustCompile(
+				`(?i)"?\b(?:access[_-]?key|api[_-]?key|password|passwd|secret|token)"?\s*[:=]\s*"?(?P<secret>[^"\s,&;]+)`,
+			),
+		},
+		{
+			name: "access-key",
+			re:   regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`),
+			// Tunnel IDs are UUIDs too.
+			tunnelIDs: true,
+		},
+	}
+
+	// Username in REST API paths e.g. "/rest/v1/<username>/tunnels".
+	usernamePathRe = regexp.MustCompile(`/rest/v1(?:\.\d+)?/(?P<secret>[^/\s?#"]+)`)
+
+	// End of a tunnel ID path segment e.g. "/tunnels/<id>?wait=true".
+	pathSegmentEndRe = regexp.MustCompile(`^(?:$|[/?#"'\s])`)
+
+	// Headers whose values are always secret.
+	secretHeaders = map[string]bool{
+		"Authorization":       true,
+		"Cookie":              true,
+		"Proxy-Authorization": true,
+		"Set-Cookie":          true,
+		"X-Api-Key":           true,
+	}
+
+	// Command line flags whose values are always secret.
+	secretFlags = map[string]bool{
+		"-k":                       true,
+		"--access-key":             true,
+		"--api-key":                true,
+		"--auth":                   true,
+		"--proxy-userpwd":          true,
+		"--tunnel-cert-password":   true,
+		"--upstream-proxy-userpwd": true,
+	}
+
+	// Path segments following "/rest/v1/" that are not usernames.
+	publicPaths = map[string]bool{"public": true}
+)
+
+// DefaultRedactor is the redactor used by Redact, and by the REST API client
+// errors.
+var DefaultRedactor = NewRedactor()
+
+type namedPattern struct {
+	name string
+	re   *regexp.Regexp
+	// tunnelIDs is set if the matches may be tunnel IDs, which are kept
+	// readable, see Redactor.AddTunnelID.
+	tunnelIDs bool
+}
+
+// Redactor removes secrets such as access keys, tokens, and passwords from
+// text, headers, and command lines. It's safe for concurrent use.
+type Redactor struct {
+	// HashUsernames replaces usernames in REST API URL paths with a short
+	// hash, so that requests of the same user can still be correlated.
+	HashUsernames bool
+
+	mu        sync.RWMutex
+	patterns  []namedPattern
+	secrets   []string
+	tunnelIDs map[string]bool
+}
+
+// NewRedactor returns a Redactor with the built-in detectors.
+func NewRedactor() *Redactor {
+	return &Redactor{
+		patterns: append([]namedPattern{}, builtinPatterns...),
+	}
+}
+
+// AddPattern registers a custom detector. If `re` has a group named "secret",
+// only that group is redacted, otherwise the whole match is.
+func (r *Redactor) AddPattern(name string, re *regexp.Regexp) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.patterns = append(r.patterns, namedPattern{name: name, re: re})
+}
+
+// AddSecret registers a literal secret, e.g. an API key, that is redacted
+// wherever it appears.
+func (r *Redactor) AddSecret(secret string) {
+	if secret == "" {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, s := range r.secrets {
+		if s == secret {
+			return
+		}
+	}
+
+	r.secrets = append(r.secrets, secret)
+}
+
+// AddTunnelID registers a tunnel ID that is kept readable, although it looks
+// like an access key. The tunnel IDs in "/tunnels/<id>" URL paths are always
+// kept readable.
+func (r *Redactor) AddTunnelID(id string) {
+	if id == "" {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.tunnelIDs == nil {
+		r.tunnelIDs = make(map[string]bool)
+	}
+
+	r.tunnelIDs[id] = true
+}
+
+// Redact returns `s` with all the detected secrets masked.
+func (r *Redactor) Redact(s string) string {
+	if s == "" {
+		return s
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, secret := range r.secrets {
+		s = strings.ReplaceAll(s, secret, Mask)
+	}
+
+	for _, p := range r.patterns {
+		var keep func(s string, start, end int) bool
+		if p.tunnelIDs {
+			keep = r.isTunnelID
+		}
+
+		s = replaceSecret(p.re, s, keep, func(string) string { return Mask })
+	}
+
+	if r.HashUsernames {
+		s = replaceSecret(usernamePathRe, s, nil, func(username string) string {
+			if publicPaths[username] || username == Mask {
+				return username
+			}
+
+			return HashUsername(username)
+		})
+	}
+
+	return s
+}
+
+// IsSecretHeader reports whether the values of the header `name`, e.g.
+// "Authorization", are always secret.
+func IsSecretHeader(name string) bool {
+	return secretHeaders[http.CanonicalHeaderKey(name)]
+}
+
+// RedactHeader returns the redacted value of the header `name`.
+func (r *Redactor) RedactHeader(name, value string) string {
+	if IsSecretHeader(name) {
+		return Mask
+	}
+
+	return r.Redact(value)
+}
+
+// RedactHeaders returns a redacted copy of `h`.
+func (r *Redactor) RedactHeaders(h http.Header) http.Header {
+	out := make(http.Header, len(h))
+
+	for name, values := range h {
+		redactedValues := make([]string, len(values))
+		for i, v := range values {
+			redactedValues[i] = r.RedactHeader(name, v)
+		}
+
+		out[name] = redactedValues
+	}
+
+	return out
+}
+
+// RedactArgs returns a redacted copy of the command line `args`. Values of
+// known secret flags are masked, in both "--flag value" and "--flag=value"
+// forms.
+func (r *Redactor) RedactArgs(args []string) []string {
+	out := make([]string, len(args))
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		if name, _, ok := strings.Cut(arg, "="); ok && secretFlags[name] {
+			out[i] = name + "=" + Mask
+
+			continue
+		}
+
+		out[i] = r.Redact(arg)
+
+		if secretFlags[arg] && i+1 < len(args) {
+			i++
+			out[i] = Mask
+		}
+	}
+
+	return out
+}
+
+// Redact masks secrets in `s` with the DefaultRedactor.
+func Redact(s string) string {
+	return DefaultRedactor.Redact(s)
+}
+
+// HashUsername returns a short, stable hash of a username.
+func HashUsername(username string) string {
+	sum := sha256.Sum256([]byte(username))
+
+	return "user-" + hex.EncodeToString(sum[:4])
+}
+
+// isTunnelID reports whether `s[start:end]` is a registered tunnel ID, or the
+// tunnel ID of a "/tunnels/<id>" URL path.
+func (r *Redactor) isTunnelID(s string, start, end int) bool {
+	if r.tunnelIDs[s[start:end]] {
+		return true
+	}
+
+	return strings.HasSuffix(s[:start], "/tunnels/") && pathSegmentEndRe.MatchString(s[end:])
+}
+
+// replaceSecret replaces the "secret" group, or the whole match, of every
+// match of `re` in `s` with the result of `repl`. The matches for which `keep`,
+// if set, returns true are left as is.
+func replaceSecret(
+	re *regexp.Regexp,
+	s string,
+	keep func(s string, start, end int) bool,
+	repl func(string) string,
+) string {
+	group := re.SubexpIndex(secretGroup)
+
+	var (
+		b    strings.Builder
+		last int
+	)
+
+	for _, m := range re.FindAllStringSubmatchIndex(s, -1) {
+		start, end := m[0], m[1]
+
+		if keep != nil && keep(s, start, end) {
+			continue
+		}
+
+		if group > 0 && m[2*group] >= 0 {
+			start, end = m[2*group], m[2*group+1]
+		}
+
+		b.WriteString(s[last:start])
+		b.WriteString(repl(s[start:end]))
+		last = end
+	}
+
+	if last == 0 {
+		return s
+	}
+
+	b.WriteString(s[last:])
+
+	return b.String()
+}
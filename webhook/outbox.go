@@ -0,0 +1,86 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const outboxPattern = "event-*.json"
+
+// Outbox persists events in a directory, one file per event, until they're
+// delivered. Files are named after the event time, so that pending events are
+// delivered in order.
+type Outbox struct {
+	// Dir is created on the first Put.
+	Dir string
+}
+
+// Put persists `ev`. The file is written atomically.
+func (o *Outbox) Put(ev Event) error {
+	if err := os.MkdirAll(o.Dir, 0o700); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	name := o.path(ev)
+
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, name)
+}
+
+// Remove removes `ev`, removing a missing event isn't an error.
+func (o *Outbox) Remove(ev Event) error {
+	if err := os.Remove(o.path(ev)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// Pending returns the persisted events, oldest first. Corrupted files are
+// removed.
+func (o *Outbox) Pending() ([]Event, error) {
+	files, err := filepath.Glob(filepath.Join(o.Dir, outboxPattern))
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(files)
+
+	events := make([]Event, 0, len(files))
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		var ev Event
+		if err := json.Unmarshal(data, &ev); err != nil {
+			// A corrupted event will never be delivered.
+			_ = os.Remove(file)
+
+			continue
+		}
+
+		events = append(events, ev)
+	}
+
+	return events, nil
+}
+
+func (o *Outbox) path(ev Event) string {
+	return filepath.Join(o.Dir, fmt.Sprintf("event-%020d-%s.json", ev.Time.UnixNano(), ev.ID))
+}
@@ -0,0 +1,65 @@
+package webhook
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	rest "github.com/saucelabs/tunnelrest-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutbox(t *testing.T) {
+	o := &Outbox{Dir: filepath.Join(t.TempDir(), "outbox")}
+
+	first := NewEvent(EventCreated, rest.TunnelState{ID: "1"})
+	second := NewEvent(EventReady, rest.TunnelState{ID: "1"})
+	second.Time = first.Time.Add(time.Second)
+
+	assert.NoError(t, o.Put(second))
+	assert.NoError(t, o.Put(first))
+	assert.NoError(t, os.WriteFile(filepath.Join(o.Dir, "event-0-corrupted.json"), []byte("{"), 0o600))
+
+	events, err := o.Pending()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{first.ID, second.ID}, []string{events[0].ID, events[1].ID})
+
+	assert.NoError(t, o.Remove(first))
+	assert.NoError(t, o.Remove(first))
+
+	events, err = o.Pending()
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+}
+
+func TestNotifierOutbox(t *testing.T) {
+	r, server := newReceiver(http.StatusBadGateway)
+	defer server.Close()
+
+	dir := t.TempDir()
+	n := &Notifier{URL: server.URL, MaxAttempts: 1, Outbox: &Outbox{Dir: dir}}
+
+	ev := NewEvent(EventShutdown, rest.TunnelState{ID: "1"})
+	assert.Error(t, n.Notify(context.Background(), ev))
+
+	// A new notifier, e.g. after a restart, delivers the pending event.
+	n = &Notifier{URL: server.URL, Outbox: &Outbox{Dir: dir}}
+	assert.NoError(t, n.Flush(context.Background()))
+
+	events := r.events(t)
+	assert.Len(t, events, 2)
+	assert.Equal(t, ev.ID, events[1].ID)
+
+	pending, err := n.Outbox.Pending()
+	assert.NoError(t, err)
+	assert.Empty(t, pending)
+
+	// Delivered events aren't kept.
+	assert.NoError(t, n.Notify(context.Background(), NewEvent(EventReady, rest.TunnelState{})))
+
+	pending, _ = n.Outbox.Pending()
+	assert.Empty(t, pending)
+}
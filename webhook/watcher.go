@@ -0,0 +1,86 @@
+package webhook
+
+import (
+	"context"
+	"time"
+
+	rest "github.com/saucelabs/tunnelrest-go"
+)
+
+const (
+	defaultWatchInterval    = 10 * time.Second
+	defaultWatchMaxFailures = 3
+)
+
+// Watcher polls the state of a tunnel, and notifies EventReady when it
+// becomes ready, EventShutdown when it's shut down, and EventPollFailed when
+// its state can't be retrieved MaxFailures times in a row.
+type Watcher struct {
+	// Client is used to poll the tunnel state.
+	Client *rest.Client
+	// Notifier delivers the events, delivery errors are passed to its
+	// OnError.
+	Notifier *Notifier
+	// TunnelID is the ID of the watched tunnel.
+	TunnelID string
+	// Interval between polls. Defaults to 10s.
+	Interval time.Duration
+	// MaxFailures is the number of consecutive polling failures notified as
+	// EventPollFailed. Defaults to 3.
+	MaxFailures int
+}
+
+// Run polls the tunnel until it's shut down, or `ctx` is done. It returns
+// nil once the tunnel is shut down, ctx.Err() otherwise.
+func (w *Watcher) Run(ctx context.Context) error {
+	interval := w.Interval
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+
+	maxFailures := w.MaxFailures
+	if maxFailures <= 0 {
+		maxFailures = defaultWatchMaxFailures
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	ready := false
+	failures := 0
+
+	for {
+		state, err := w.Client.TunnelState(ctx, w.TunnelID)
+
+		switch {
+		case err != nil:
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			// Notified once per streak of failures.
+			if failures++; failures == maxFailures {
+				ev := NewEvent(EventPollFailed, rest.TunnelState{ID: w.TunnelID})
+				ev.Error = err.Error()
+				w.Notifier.tryNotify(ctx, ev)
+			}
+		case state.Status == rest.TunnelStatusTerminated || state.ShutdownTime != 0:
+			w.Notifier.tryNotify(ctx, NewEvent(EventShutdown, state))
+
+			return nil
+		default:
+			failures = 0
+
+			if state.IsReady && !ready {
+				ready = true
+				w.Notifier.tryNotify(ctx, NewEvent(EventReady, state))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
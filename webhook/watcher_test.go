@@ -0,0 +1,93 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	rest "github.com/saucelabs/tunnelrest-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatcher(t *testing.T) {
+	r, server := newReceiver()
+	defer server.Close()
+
+	var (
+		mu    sync.Mutex
+		polls int
+	)
+
+	// The tunnel is not ready, ready, then the API fails twice, and the
+	// tunnel is shut down.
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		polls++
+
+		state := rest.TunnelState{ID: "t1", TunnelIdentifier: "app"}
+
+		switch polls {
+		case 1:
+		case 2, 3:
+			state.IsReady = true
+		case 4, 5:
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+
+			return
+		default:
+			state.Status = "terminated"
+			state.ShutdownReason = "sigterm"
+		}
+
+		_ = json.NewEncoder(w).Encode(state)
+	}))
+	defer api.Close()
+
+	w := &Watcher{
+		Client:      &rest.Client{BaseURL: api.URL, User: "bob"},
+		Notifier:    &Notifier{URL: server.URL},
+		TunnelID:    "t1",
+		Interval:    time.Millisecond,
+		MaxFailures: 2,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	assert.NoError(t, w.Run(ctx))
+
+	events := r.events(t)
+	types := make([]EventType, len(events))
+	for i, ev := range events {
+		types[i] = ev.Type
+	}
+
+	assert.Equal(t, []EventType{EventReady, EventPollFailed, EventShutdown}, types)
+	assert.Contains(t, events[1].Error, "503")
+	assert.Equal(t, "sigterm", events[2].ShutdownReason)
+}
+
+func TestWatcherCancel(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_ = json.NewEncoder(w).Encode(rest.TunnelState{ID: "t1"})
+	}))
+	defer api.Close()
+
+	w := &Watcher{
+		Client:   &rest.Client{BaseURL: api.URL, User: "bob"},
+		Notifier: &Notifier{URL: "http://127.0.0.1:0"},
+		TunnelID: "t1",
+		Interval: time.Millisecond,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	assert.ErrorIs(t, w.Run(ctx), context.DeadlineExceeded)
+}
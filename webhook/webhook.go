@@ -0,0 +1,518 @@
+// Package webhook pushes tunnel events to outbound webhooks.
+//
+// Payloads are signed with HMAC-SHA256, failed deliveries are retried with
+// exponential backoff, and events can be persisted in an Outbox so they
+// survive restarts.
+//
+// Usage:
+//
+//	n := &webhook.Notifier{URL: "https://hooks.example.com/sc", Secret: secret,
+//		Outbox: &webhook.Outbox{Dir: "/var/lib/sc/outbox"}}
+//	_ = n.Flush(ctx) // Events left over by a previous run.
+//	w := &webhook.Watcher{Client: client, Notifier: n, TunnelID: tunnel.ID}
+//	go client.Heartbeat(ctx, tunnel.ID, time.Minute, n.HeartbeatErrorHandler(tunnel.ID))
+//	_ = w.Run(ctx)
+//	n.Wait() // Events delivered in the background.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	rest "github.com/saucelabs/tunnelrest-go"
+	"github.com/saucelabs/tunnelrest-go/util"
+)
+
+const (
+	// SignatureHeader carries the "sha256=<hex>" HMAC of the payload.
+	SignatureHeader = "X-Webhook-Signature"
+	// EventHeader carries the event type.
+	EventHeader = "X-Webhook-Event"
+	// IDHeader carries the event ID, receivers may use it to drop duplicates.
+	IDHeader = "X-Webhook-ID"
+
+	defaultMaxAttempts = 5
+	defaultMinBackoff  = time.Second
+	defaultMaxBackoff  = time.Minute
+	defaultTimeout     = 10 * time.Second
+)
+
+// EventType is the type of tunnel event.
+type EventType string
+
+const (
+	EventCreated         EventType = "tunnel.created"
+	EventReady           EventType = "tunnel.ready"
+	EventShutdown        EventType = "tunnel.shutdown"
+	EventPollFailed      EventType = "tunnel.poll_failed"
+	EventHeartbeatFailed EventType = "tunnel.heartbeat_failed"
+	EventFatalMessage    EventType = "tunnel.fatal_message"
+)
+
+// Event is a tunnel event.
+type Event struct {
+	ID               string    `json:"id"`
+	Type             EventType `json:"type"`
+	Time             time.Time `json:"time"`
+	TunnelID         string    `json:"tunnel_id,omitempty"`
+	TunnelIdentifier string    `json:"tunnel_identifier,omitempty"`
+	Owner            string    `json:"owner,omitempty"`
+	ShutdownReason   string    `json:"shutdown_reason,omitempty"`
+	// Message is the server message of EventFatalMessage events.
+	Message string `json:"message,omitempty"`
+	// Error is the last polling error of EventPollFailed events, or the
+	// client status update error of EventHeartbeatFailed events.
+	Error string `json:"error,omitempty"`
+}
+
+// NewEvent returns an event of type `t` about the tunnel `state`.
+func NewEvent(t EventType, state rest.TunnelState) Event {
+	return Event{
+		ID:               newID(),
+		Type:             t,
+		Time:             time.Now().UTC(),
+		TunnelID:         state.ID,
+		TunnelIdentifier: state.TunnelIdentifier,
+		Owner:            state.Owner,
+		ShutdownReason:   state.ShutdownReason,
+	}
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+
+	return hex.EncodeToString(b)
+}
+
+// DeliveryError is returned when an event can't be delivered.
+type DeliveryError struct {
+	Event EventType
+	// StatusCode of the last attempt, 0 if the receiver wasn't reached.
+	StatusCode int
+	Attempts   int
+	Err        error
+	// Permanent errors aren't retried, e.g. the receiver rejected the event.
+	Permanent bool
+}
+
+// Error interface implementation.
+func (e *DeliveryError) Error() string {
+	msg := fmt.Sprintf("webhook %s: delivery failed after %d attempt(s)", e.Event, e.Attempts)
+
+	if e.StatusCode != 0 {
+		msg = fmt.Sprintf("%s - %d (%s)", msg, e.StatusCode, http.StatusText(e.StatusCode))
+	}
+
+	if e.Err != nil {
+		msg = fmt.Sprintf("%s: %v", msg, e.Err)
+	}
+
+	return util.Redact(msg)
+}
+
+// Unwrap interface implementation.
+func (e *DeliveryError) Unwrap() error { return e.Err }
+
+// ParseTemplate parses a payload template. Templates are executed with the
+// Event, and must produce JSON. The "json" function encodes a value as JSON,
+// e.g. {"text": {{json .Message}}}.
+func ParseTemplate(text string) (*template.Template, error) {
+	return template.New("webhook").Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			b, err := json.Marshal(v)
+
+			return string(b), err
+		},
+	}).Parse(text)
+}
+
+// Notifier delivers events to a webhook.
+type Notifier struct {
+	// URL of the webhook.
+	URL string
+	// Secret signs the payloads, see Sign. Payloads aren't signed if empty.
+	Secret []byte
+	// Template renders the payload, see ParseTemplate. Defaults to the Event
+	// encoded as JSON.
+	Template *template.Template
+	// Headers that are set on each request.
+	Headers map[string]string
+
+	// MaxAttempts is the number of delivery attempts. Defaults to 5.
+	MaxAttempts int
+	// MinBackoff is the delay before the first retry, doubled after each
+	// attempt. Defaults to 1s.
+	MinBackoff time.Duration
+	// MaxBackoff caps the delay between attempts. Defaults to 1m.
+	MaxBackoff time.Duration
+	// Timeout of a single attempt. Defaults to 10s.
+	Timeout time.Duration
+
+	// Outbox, if set, persists events until they're delivered.
+	Outbox *Outbox
+
+	// OnError is called with delivery errors of events sent on behalf of
+	// other calls, e.g. by the Watcher or CreateTunnelV5.
+	OnError func(error)
+
+	// RoundTrip is used to make HTTP requests, if not set, the default
+	// http.Client is used.
+	RoundTrip func(*http.Request) (*http.Response, error)
+
+	// background tracks the events delivered in the background.
+	background sync.WaitGroup
+}
+
+// Notify delivers `ev`. With an Outbox, the event is persisted first, and
+// left there for Flush if the delivery fails with a retryable error.
+func (n *Notifier) Notify(ctx context.Context, ev Event) error {
+	if n.Outbox == nil {
+		return n.Send(ctx, ev)
+	}
+
+	if err := n.Outbox.Put(ev); err != nil {
+		return err
+	}
+
+	return n.deliver(ctx, ev)
+}
+
+// deliver sends `ev` persisted in the Outbox, and removes it unless it's left
+// for Flush.
+func (n *Notifier) deliver(ctx context.Context, ev Event) error {
+	err := n.Send(ctx, ev)
+
+	var dE *DeliveryError
+	if err == nil || (errors.As(err, &dE) && dE.Permanent) {
+		if rmErr := n.Outbox.Remove(ev); rmErr != nil && err == nil {
+			err = rmErr
+		}
+	}
+
+	return err
+}
+
+// Flush delivers the events left in the Outbox, oldest first. It stops at
+// the first retryable error, events rejected by the receiver are dropped.
+func (n *Notifier) Flush(ctx context.Context) error {
+	if n.Outbox == nil {
+		return nil
+	}
+
+	events, err := n.Outbox.Pending()
+	if err != nil {
+		return err
+	}
+
+	for _, ev := range events {
+		err := n.Send(ctx, ev)
+
+		var dE *DeliveryError
+		if err != nil && !(errors.As(err, &dE) && dE.Permanent) {
+			return err
+		}
+
+		if err := n.Outbox.Remove(ev); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Send delivers `ev`, retrying network errors, 408, 429 and 5xx responses.
+// All errors are of type *DeliveryError.
+func (n *Notifier) Send(ctx context.Context, ev Event) error {
+	payload, err := n.payload(ev)
+	if err != nil {
+		return &DeliveryError{Event: ev.Type, Err: err, Permanent: true}
+	}
+
+	attempts := n.MaxAttempts
+	if attempts <= 0 {
+		attempts = defaultMaxAttempts
+	}
+
+	backoff := n.MinBackoff
+	if backoff <= 0 {
+		backoff = defaultMinBackoff
+	}
+
+	maxBackoff := n.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = defaultMaxBackoff
+	}
+
+	for attempt := 1; ; attempt++ {
+		dE := n.attempt(ctx, ev, payload)
+		if dE == nil {
+			return nil
+		}
+
+		dE.Attempts = attempt
+
+		if dE.Permanent || attempt >= attempts {
+			return dE
+		}
+
+		select {
+		case <-ctx.Done():
+			dE.Err = ctx.Err()
+
+			return dE
+		case <-time.After(backoff):
+		}
+
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+func (n *Notifier) attempt(ctx context.Context, ev Event, payload []byte) *DeliveryError {
+	timeout := n.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(payload))
+	if err != nil {
+		return &DeliveryError{Event: ev.Type, Err: err, Permanent: true}
+	}
+
+	for header, val := range n.Headers {
+		req.Header.Set(header, val)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "SauceLabs/tunnelrest-go")
+	req.Header.Set(EventHeader, string(ev.Type))
+	req.Header.Set(IDHeader, ev.ID)
+
+	if len(n.Secret) > 0 {
+		req.Header.Set(SignatureHeader, Sign(n.Secret, payload))
+	}
+
+	var resp *http.Response
+	if n.RoundTrip != nil {
+		resp, err = n.RoundTrip(req) //nolint:bodyclose // Closed later
+	} else {
+		resp, err = http.DefaultClient.Do(req) //nolint:bodyclose // Closed later
+	}
+
+	if err != nil {
+		return &DeliveryError{Event: ev.Type, Err: err}
+	}
+
+	defer resp.Body.Close()
+
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices {
+		return nil
+	}
+
+	retryable := resp.StatusCode == http.StatusRequestTimeout ||
+		resp.StatusCode == http.StatusTooManyRequests ||
+		resp.StatusCode >= http.StatusInternalServerError
+
+	return &DeliveryError{Event: ev.Type, StatusCode: resp.StatusCode, Permanent: !retryable}
+}
+
+func (n *Notifier) payload(ev Event) ([]byte, error) {
+	if n.Template == nil {
+		return json.Marshal(ev)
+	}
+
+	var buf bytes.Buffer
+	if err := n.Template.Execute(&buf, ev); err != nil {
+		return nil, err
+	}
+
+	if !json.Valid(buf.Bytes()) {
+		return nil, fmt.Errorf("template %q did not produce valid JSON", n.Template.Name())
+	}
+
+	return buf.Bytes(), nil
+}
+
+// tryNotify notifies `ev`, errors are passed to OnError.
+func (n *Notifier) tryNotify(ctx context.Context, ev Event) {
+	if err := n.Notify(ctx, ev); err != nil {
+		n.onError(err)
+	}
+}
+
+// notifyAsync notifies `events` in order, in the background, so that retries
+// don't hold the caller. With an Outbox, the events are persisted before
+// notifyAsync returns. Errors are passed to OnError.
+func (n *Notifier) notifyAsync(events ...Event) {
+	if len(events) == 0 {
+		return
+	}
+
+	persisted := make([]bool, len(events))
+
+	if n.Outbox != nil {
+		for i, ev := range events {
+			if err := n.Outbox.Put(ev); err != nil {
+				n.onError(err)
+
+				continue
+			}
+
+			persisted[i] = true
+		}
+	}
+
+	n.background.Add(1)
+
+	go func() {
+		defer n.background.Done()
+
+		// The caller context may be done once it returned.
+		ctx := context.Background()
+
+		for i, ev := range events {
+			var err error
+			if persisted[i] {
+				err = n.deliver(ctx, ev)
+			} else {
+				err = n.Send(ctx, ev)
+			}
+
+			if err != nil {
+				n.onError(err)
+			}
+		}
+	}()
+}
+
+// Wait waits for the events delivered in the background, e.g. before the
+// process exits.
+func (n *Notifier) Wait() {
+	n.background.Wait()
+}
+
+func (n *Notifier) onError(err error) {
+	if n.OnError != nil {
+		n.OnError(err)
+	}
+}
+
+// CreateTunnelV5 creates a tunnel with `c`, and notifies EventCreated. Fatal
+// messages of the response are notified as EventFatalMessage. Events are
+// delivered in the background, see Wait.
+func (n *Notifier) CreateTunnelV5(
+	ctx context.Context, c *rest.Client, req *rest.CreateTunnelRequestV5, timeout time.Duration,
+) (rest.TunnelStateWithMessages, error) {
+	tunnel, err := c.CreateTunnelV5(ctx, req, timeout)
+
+	// A FatalMessageError is returned along with the created tunnel.
+	if tunnel.ID != "" {
+		events := []Event{NewEvent(EventCreated, tunnel.TunnelState)}
+
+		for _, text := range tunnel.Messages.Fatal {
+			ev := NewEvent(EventFatalMessage, tunnel.TunnelState)
+			ev.Message = text
+			events = append(events, ev)
+		}
+
+		n.notifyAsync(events...)
+	}
+
+	return tunnel, err
+}
+
+// ShutdownTunnel shuts down the tunnel `id` with `c`, and notifies
+// EventShutdown. The event is delivered in the background, see Wait.
+func (n *Notifier) ShutdownTunnel(
+	ctx context.Context, c *rest.Client, id, reason string, wait bool,
+) (int, error) {
+	jobs, err := c.ShutdownTunnel(ctx, id, reason, wait)
+	if err != nil {
+		return jobs, err
+	}
+
+	ev := NewEvent(EventShutdown, rest.TunnelState{ID: id})
+	ev.ShutdownReason = reason
+	n.notifyAsync(ev)
+
+	return jobs, nil
+}
+
+// UpdateClientStatus updates the client status of the tunnel `id` with `c`,
+// and notifies EventHeartbeatFailed if it fails. The event is delivered in
+// the background, see Wait.
+func (n *Notifier) UpdateClientStatus(
+	ctx context.Context, c *rest.Client, id string, connected bool, duration time.Duration, memory *rest.Memory,
+) (rest.UpdateClientStatusResponse, error) {
+	resp, err := c.UpdateClientStatus(ctx, id, connected, duration, memory)
+	if err != nil {
+		n.HeartbeatErrorHandler(id)(err)
+	}
+
+	return resp, err
+}
+
+// HeartbeatErrorHandler returns an error handler for rest.Client.Heartbeat of
+// the tunnel `id`, notifying each failed client status update as
+// EventHeartbeatFailed. Events are delivered in the background, see Wait.
+func (n *Notifier) HeartbeatErrorHandler(id string) func(error) {
+	return func(err error) {
+		ev := NewEvent(EventHeartbeatFailed, rest.TunnelState{ID: id})
+		ev.Error = err.Error()
+		n.notifyAsync(ev)
+	}
+}
+
+// MessageHandler returns a rest.MessageHandler notifying fatal messages as
+// EventFatalMessage events, e.g. the ones returned by GetSCUpdates. Events
+// are delivered in the background, see Wait.
+func (n *Notifier) MessageHandler() rest.MessageHandler {
+	return rest.MessageHandlerFunc(func(m rest.Message) {
+		if m.Severity != rest.SeverityFatal {
+			return
+		}
+
+		ev := NewEvent(EventFatalMessage, rest.TunnelState{})
+		ev.Message = m.Text
+		n.notifyAsync(ev)
+	})
+}
+
+// Sign returns the "sha256=<hex>" HMAC-SHA256 signature of `payload`.
+func Sign(secret, payload []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature of `payload`, for use by receivers.
+func Verify(secret, payload []byte, signature string) bool {
+	if !strings.HasPrefix(signature, "sha256=") {
+		return false
+	}
+
+	return hmac.Equal([]byte(Sign(secret, payload)), []byte(signature))
+}
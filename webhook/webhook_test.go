@@ -0,0 +1,262 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	rest "github.com/saucelabs/tunnelrest-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// receiver is a webhook receiver, responding with the queued status codes,
+// then 200.
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, body)
+
+	if len(r.statuses) > 0 {
+		w.WriteHeader(r.statuses[0])
+		r.statuses = r.statuses[1:]
+	}
+}
+
+func (r *receiver) events(t *testing.T) []Event {
+	t.Helper()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	events := make([]Event, len(r.bodies))
+	for i, b := range r.bodies {
+		assert.NoError(t, json.Unmarshal(b, &events[i]))
+	}
+
+	return events
+}
+
+func newReceiver(statuses ...int) (*receiver, *httptest.Server) {
+	r := &receiver{statuses: statuses}
+
+	return r, httptest.NewServer(r)
+}
+
+func TestNotifierSend(t *testing.T) {
+	r, server := newReceiver()
+	defer server.Close()
+
+	n := &Notifier{URL: server.URL, Secret: []byte("s3cret")}
+	ev := NewEvent(EventShutdown, rest.TunnelState{ID: "1", TunnelIdentifier: "app", ShutdownReason: "sigterm"})
+
+	assert.NoError(t, n.Send(context.Background(), ev))
+
+	assert.Len(t, r.requests, 1)
+	req := r.requests[0]
+	assert.Equal(t, string(EventShutdown), req.Header.Get(EventHeader))
+	assert.Equal(t, ev.ID, req.Header.Get(IDHeader))
+	assert.True(t, Verify([]byte("s3cret"), r.bodies[0], req.Header.Get(SignatureHeader)))
+	assert.False(t, Verify([]byte("other"), r.bodies[0], req.Header.Get(SignatureHeader)))
+
+	got := r.events(t)[0]
+	assert.Equal(t, "sigterm", got.ShutdownReason)
+	assert.Equal(t, "app", got.TunnelIdentifier)
+}
+
+func TestNotifierTemplate(t *testing.T) {
+	r, server := newReceiver()
+	defer server.Close()
+
+	tmpl, err := ParseTemplate(`{"text": {{json (printf "%s: %s" .Type .Message)}}}`)
+	assert.NoError(t, err)
+
+	n := &Notifier{URL: server.URL, Template: tmpl}
+	ev := NewEvent(EventFatalMessage, rest.TunnelState{})
+	ev.Message = `version "4.6" is blocked`
+
+	assert.NoError(t, n.Send(context.Background(), ev))
+	assert.JSONEq(t, `{"text": "tunnel.fatal_message: version \"4.6\" is blocked"}`, string(r.bodies[0]))
+
+	tmpl, _ = ParseTemplate(`{"text": {{.Message}}}`)
+	n.Template = tmpl
+
+	var dE *DeliveryError
+	assert.True(t, errors.As(n.Send(context.Background(), ev), &dE))
+	assert.True(t, dE.Permanent)
+	assert.Len(t, r.requests, 1)
+}
+
+func TestNotifierRetries(t *testing.T) {
+	r, server := newReceiver(http.StatusServiceUnavailable, http.StatusTooManyRequests)
+	defer server.Close()
+
+	n := &Notifier{URL: server.URL, MinBackoff: time.Millisecond}
+	assert.NoError(t, n.Send(context.Background(), NewEvent(EventReady, rest.TunnelState{ID: "1"})))
+	assert.Len(t, r.requests, 3)
+
+	r.statuses = []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError}
+	n.MaxAttempts = 2
+
+	err := n.Send(context.Background(), NewEvent(EventReady, rest.TunnelState{ID: "1"}))
+	assert.EqualError(t, err, "webhook tunnel.ready: delivery failed after 2 attempt(s) - 500 (Internal Server Error)")
+
+	r.statuses = []int{http.StatusBadRequest}
+
+	var dE *DeliveryError
+	assert.True(t, errors.As(n.Send(context.Background(), NewEvent(EventReady, rest.TunnelState{})), &dE))
+	assert.True(t, dE.Permanent)
+	assert.Equal(t, 1, dE.Attempts)
+}
+
+func TestNotifierCreateAndShutdown(t *testing.T) {
+	r, server := newReceiver()
+	defer server.Close()
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case http.MethodPost:
+			_, _ = io.WriteString(w, `{"id": "t1", "tunnel_identifier": "app", "messages": {"fatal": ["blocked"]}}`)
+		case http.MethodDelete:
+			_, _ = io.WriteString(w, `{"jobs_running": 0}`)
+		}
+	}))
+	defer api.Close()
+
+	client := &rest.Client{BaseURL: api.URL, User: "bob"}
+	n := &Notifier{URL: server.URL}
+
+	tunnel, err := n.CreateTunnelV5(context.Background(), client, &rest.CreateTunnelRequestV5{}, time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, "t1", tunnel.ID)
+
+	// Events of a call are delivered in order.
+	n.Wait()
+
+	_, err = n.ShutdownTunnel(context.Background(), client, "t1", "sigterm", false)
+	assert.NoError(t, err)
+
+	n.Wait()
+
+	events := r.events(t)
+	assert.Len(t, events, 3)
+	assert.Equal(t, EventCreated, events[0].Type)
+	assert.Equal(t, "app", events[0].TunnelIdentifier)
+	assert.Equal(t, EventFatalMessage, events[1].Type)
+	assert.Equal(t, "blocked", events[1].Message)
+	assert.Equal(t, EventShutdown, events[2].Type)
+	assert.Equal(t, "sigterm", events[2].ShutdownReason)
+}
+
+func TestNotifierCreateDoesNotWaitForDelivery(t *testing.T) {
+	release := make(chan struct{})
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-release
+	}))
+	defer receiver.Close()
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, _ = io.WriteString(w, `{"id": "t1"}`)
+	}))
+	defer api.Close()
+
+	var (
+		mu       sync.Mutex
+		failures []error
+	)
+
+	dir := t.TempDir()
+	n := &Notifier{
+		URL:         receiver.URL,
+		MaxAttempts: 1,
+		Outbox:      &Outbox{Dir: dir},
+		OnError: func(err error) {
+			mu.Lock()
+			failures = append(failures, err)
+			mu.Unlock()
+		},
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		_, err := n.CreateTunnelV5(context.Background(), &rest.Client{BaseURL: api.URL, User: "bob"},
+			&rest.CreateTunnelRequestV5{}, time.Second)
+		assert.NoError(t, err)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("CreateTunnelV5 waited for the webhook delivery")
+	}
+
+	// The event is persisted before CreateTunnelV5 returns.
+	pending, err := n.Outbox.Pending()
+	assert.NoError(t, err)
+	assert.Len(t, pending, 1)
+
+	close(release)
+	n.Wait()
+
+	pending, _ = n.Outbox.Pending()
+	assert.Empty(t, pending)
+
+	mu.Lock()
+	assert.Empty(t, failures)
+	mu.Unlock()
+}
+
+func TestNotifierHeartbeatFailed(t *testing.T) {
+	r, server := newReceiver()
+	defer server.Close()
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer api.Close()
+
+	client := &rest.Client{BaseURL: api.URL, User: "bob"}
+	n := &Notifier{URL: server.URL}
+
+	_, err := n.UpdateClientStatus(context.Background(), client, "t1", true, time.Second, nil)
+	assert.Error(t, err)
+
+	n.Wait()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	client.Heartbeat(ctx, "t1", time.Hour, func(err error) {
+		n.HeartbeatErrorHandler("t1")(err)
+		cancel()
+	})
+
+	n.Wait()
+
+	events := r.events(t)
+	assert.Len(t, events, 2)
+
+	for _, ev := range events {
+		assert.Equal(t, EventHeartbeatFailed, ev.Type)
+		assert.Equal(t, "t1", ev.TunnelID)
+		assert.Contains(t, ev.Error, "503")
+	}
+}